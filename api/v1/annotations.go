@@ -0,0 +1,32 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// AdoptAnnotation, set to "true", lets an LdapUser or LdapGroup take over
+// an existing LDAP entry of the same name. Without it the object is refused
+// with a Conflict condition.
+const AdoptAnnotation = "ldap.digitalis.io/adopt"
+
+// DefaultedAnnotation lists the spec fields the defaulting webhook filled in
+// and that still hold their default, comma separated. Adopting an existing
+// entry takes its values for them instead.
+const DefaultedAnnotation = "ldap.digitalis.io/defaulted"
+
+// adopting tells whether the object takes over an existing entry
+func adopting(annotations map[string]string) bool {
+	return annotations[AdoptAnnotation] == "true"
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"strings"
+)
+
+// reservedUserAttributes are written by the controller and can't be set in
+// LdapUserSpec.Attributes
+var reservedUserAttributes = []string{
+	"objectClass", "uid", "cn", "uidNumber", "gidNumber", "homeDirectory", "gecos", "loginShell", "userPassword",
+	"shadowExpire", "shadowMax", "shadowMin", "shadowWarning", "shadowInactive", "sshPublicKey",
+}
+
+// reservedGroupAttributes are written by the controller and can't be set in
+// LdapGroupSpec.Attributes
+var reservedGroupAttributes = []string{
+	"objectClass", "cn", "gidNumber", "memberUid", "member", "uniqueMember", "userPassword",
+}
+
+// structuralObjectClasses are well-known structural objectClasses, an entry
+// has a single structural chain so they can't be added next to the account
+// and posixGroup ones the controller writes
+var structuralObjectClasses = []string{
+	"person", "organizationalPerson", "inetOrgPerson", "residentialPerson", "account", "device",
+	"applicationProcess", "organization", "organizationalUnit", "organizationalRole",
+	"groupOfNames", "groupOfUniqueNames", "posixGroup", "country", "locality",
+}
+
+// IsReservedUserAttribute tells whether the controller owns the attribute
+// of user entries
+func IsReservedUserAttribute(name string) bool {
+	return containsFold(reservedUserAttributes, name)
+}
+
+// IsReservedGroupAttribute tells whether the controller owns the attribute
+// of group entries
+func IsReservedGroupAttribute(name string) bool {
+	return containsFold(reservedGroupAttributes, name)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types reported on users and groups
+const (
+	// ConditionReady is True when the entry exists in LDAP
+	ConditionReady = "Ready"
+	// ConditionSynced is True when the entry matches the last spec applied
+	ConditionSynced = "Synced"
+	// ConditionDegraded is True when the last reconcile failed
+	ConditionDegraded = "Degraded"
+	// ConditionConflict is True when the name or number is already used by
+	// another object or by an entry in LDAP, the object is then not written
+	ConditionConflict = "Conflict"
+)
+
+// Condition has the same shape as metav1.Condition, which is not part of
+// the apimachinery version used here
+type Condition struct {
+	Type string `json:"type"`
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status             metav1.ConditionStatus `json:"status"`
+	ObservedGeneration int64                  `json:"observedGeneration,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime"`
+	Reason             string                 `json:"reason"`
+	Message            string                 `json:"message,omitempty"`
+}
+
+// FindCondition returns the condition of the given type, or nil
+func FindCondition(conditions []Condition, conditionType string) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates a condition. LastTransitionTime only moves
+// when the status changes.
+func SetCondition(conditions *[]Condition, condition Condition) {
+	existing := FindCondition(*conditions, condition.Type)
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		*conditions = append(*conditions, condition)
+		return
+	}
+
+	if existing.Status != condition.Status {
+		existing.Status = condition.Status
+		existing.LastTransitionTime = condition.LastTransitionTime
+		if existing.LastTransitionTime.IsZero() {
+			existing.LastTransitionTime = metav1.Now()
+		}
+	}
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+	existing.ObservedGeneration = condition.ObservedGeneration
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	var conditions []Condition
+	SetCondition(&conditions, Condition{Type: ConditionReady, Status: metav1.ConditionFalse, Reason: "EntryMissing"})
+	ready := FindCondition(conditions, ConditionReady)
+	if ready == nil || ready.LastTransitionTime.IsZero() {
+		t.Fatalf("conditions = %+v, want Ready added with a transition time", conditions)
+	}
+
+	// the transition time only moves when the status does
+	past := metav1.NewTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	ready.LastTransitionTime = past
+	SetCondition(&conditions, Condition{Type: ConditionReady, Status: metav1.ConditionFalse, ObservedGeneration: 2, Reason: "LdapError", Message: "down"})
+	ready = FindCondition(conditions, ConditionReady)
+	if !ready.LastTransitionTime.Equal(&past) || ready.Reason != "LdapError" || ready.Message != "down" || ready.ObservedGeneration != 2 {
+		t.Errorf("Ready = %+v, want the reason updated and the transition time kept", ready)
+	}
+	SetCondition(&conditions, Condition{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "EntryExists"})
+	ready = FindCondition(conditions, ConditionReady)
+	if ready.LastTransitionTime.Equal(&past) || ready.Status != metav1.ConditionTrue || ready.Message != "" {
+		t.Errorf("Ready = %+v, want the transition recorded", ready)
+	}
+
+	SetCondition(&conditions, Condition{Type: ConditionSynced, Status: metav1.ConditionTrue, Reason: "Synced"})
+	if len(conditions) != 2 || FindCondition(conditions, ConditionDegraded) != nil {
+		t.Errorf("conditions = %+v, want Ready and Synced", conditions)
+	}
+}
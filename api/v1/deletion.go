@@ -0,0 +1,32 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// DeletionPolicy tells the controller what to do with the LDAP entry when the
+// object is deleted
+// +kubebuilder:validation:Enum=Delete;Retain;Disable
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete removes the entry, the default
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain leaves the entry untouched
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyDisable keeps the entry but locks users and removes them
+	// from their groups, and empties groups
+	DeletionPolicyDisable DeletionPolicy = "Disable"
+)
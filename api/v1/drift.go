@@ -0,0 +1,29 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// DriftPolicy tells the controller what to do when the LDAP entry was changed
+// outside of it
+// +kubebuilder:validation:Enum=Repair;Report
+type DriftPolicy string
+
+const (
+	// DriftPolicyRepair writes the spec back over the changes, the default
+	DriftPolicyRepair DriftPolicy = "Repair"
+	// DriftPolicyReport only records the changes in the status
+	DriftPolicyReport DriftPolicy = "Report"
+)
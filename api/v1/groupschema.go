@@ -0,0 +1,59 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// GroupSchemaMode selects the objectClasses and membership attributes
+// written on groups
+// +kubebuilder:validation:Enum=RFC2307;GroupOfNames;GroupOfUniqueNames
+type GroupSchemaMode string
+
+const (
+	// GroupSchemaRFC2307 writes posixGroup entries listing memberUid, the
+	// default
+	GroupSchemaRFC2307 GroupSchemaMode = "RFC2307"
+	// GroupSchemaGroupOfNames adds groupOfNames and lists the member DNs in
+	// member
+	GroupSchemaGroupOfNames GroupSchemaMode = "GroupOfNames"
+	// GroupSchemaGroupOfUniqueNames adds groupOfUniqueNames and lists the
+	// member DNs in uniqueMember
+	GroupSchemaGroupOfUniqueNames GroupSchemaMode = "GroupOfUniqueNames"
+)
+
+// MemberUIDFormat selects what memberUid lists
+// +kubebuilder:validation:Enum=Username;UIDNumber
+type MemberUIDFormat string
+
+const (
+	// MemberUIDUsername lists login names as defined by RFC 2307, the default
+	MemberUIDUsername MemberUIDFormat = "Username"
+	// MemberUIDNumber lists uid numbers, for legacy setups
+	MemberUIDNumber MemberUIDFormat = "UIDNumber"
+)
+
+// GroupSchema describes how groups and their members are written. The
+// GroupOfNames and GroupOfUniqueNames modes need the rfc2307bis schema, where
+// posixGroup is auxiliary.
+type GroupSchema struct {
+	// Mode defaults to RFC2307
+	Mode GroupSchemaMode `json:"mode,omitempty"`
+	// MemberUID also lists the members in memberUid in the GroupOfNames and
+	// GroupOfUniqueNames modes
+	MemberUID bool `json:"memberUid,omitempty"`
+	// MemberUIDFormat defaults to Username. Numeric members without an
+	// account are always written as numbers.
+	MemberUIDFormat MemberUIDFormat `json:"memberUidFormat,omitempty"`
+}
@@ -25,18 +25,65 @@ import (
 
 // LdapGroupSpec defines the desired state of LdapGroup
 type LdapGroupSpec struct {
-	Name    string   `json:"name"`
-	GID     string   `json:"gid"`
+	Name string `json:"name"`
+	// GID is allocated from the IDPool when left empty
+	GID     string   `json:"gid,omitempty"`
 	Members []string `json:"members,omitempty"`
+	// Server is the name of the LdapServer to use, defaults to the
+	// manager's --ldap-server
+	Server string `json:"server,omitempty"`
+	// IDPool is the LdapIDPool numbers are allocated from, defaults to the
+	// manager's --id-pool
+	IDPool string `json:"idPool,omitempty"`
+	// OU is the part of the DN between the entry and the base DN, for example
+	// "ou=Groups". Defaults to the server's setting.
+	OU string `json:"ou,omitempty"`
+	// Schema selects how the group and its members are written, defaults to
+	// the server's groupSchema
+	Schema *GroupSchema `json:"schema,omitempty"`
+	// ExtraObjectClasses are added to the entry along with the ones the
+	// controller needs, they are never removed. They must be auxiliary.
+	ExtraObjectClasses []string `json:"extraObjectClasses,omitempty"`
+	// Attributes are written to the entry as they are, an empty list
+	// removes the attribute. The attributes written by the controller and
+	// userPassword can't be set.
+	Attributes map[string][]string `json:"attributes,omitempty"`
+	// DriftPolicy is applied when the entry is found changed in LDAP on a
+	// resync, defaults to Repair
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+	// DeletionPolicy is applied to the entry when the object is deleted,
+	// defaults to the server's deletionPolicy
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
 }
 
 // LdapGroupStatus defines the observed state of LdapGroup
 type LdapGroupStatus struct {
 	CreatedOn string `json:"createdOn,omitempty"`
 	UpdatedOn string `json:"updatedOn,omitempty"`
+	// ObservedGeneration is the generation last reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// DN of the entry in LDAP
+	DN         string      `json:"dn,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	// Drift lists the attributes found changed in LDAP on the last resync,
+	// or "entry" when the entry was missing
+	Drift []string `json:"drift,omitempty"`
+	// ResolvedMembers lists the memberUid values last written, or the member
+	// DNs when memberUid is not used
+	ResolvedMembers []string `json:"resolvedMembers,omitempty"`
+	// MissingMembers lists the members that were not found in LDAP
+	MissingMembers []string `json:"missingMembers,omitempty"`
+	// Managed is set once the controller created or adopted the entry, it
+	// never writes to an existing entry it doesn't manage
+	Managed bool `json:"managed,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+// +kubebuilder:printcolumn:name="DN",type=string,JSONPath=`.status.dn`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // LdapGroup is the Schema for the ldapgroups API
 type LdapGroup struct {
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var ldapgrouplog = logf.Log.WithName("ldapgroup-resource")
+
+func (r *LdapGroup) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	webhookClient = mgr.GetClient()
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-ldap-digitalis-io-v1-ldapgroup,mutating=false,failurePolicy=fail,groups=ldap.digitalis.io,resources=ldapgroups,versions=v1,name=vldapgroup.kb.io
+
+var _ webhook.Validator = &LdapGroup{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *LdapGroup) ValidateCreate() error {
+	ldapgrouplog.Info("validate create", "name", r.Name)
+	return r.validate(nil)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *LdapGroup) ValidateUpdate(old runtime.Object) error {
+	ldapgrouplog.Info("validate update", "name", r.Name)
+	// objects created before the webhook must still be able to drop their
+	// finalizer
+	if r.DeletionTimestamp != nil {
+		return nil
+	}
+	return r.validate(old.(*LdapGroup))
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *LdapGroup) ValidateDelete() error {
+	return nil
+}
+
+// validate checks the spec, and that the name and number aren't used by
+// another object when they are new
+func (r *LdapGroup) validate(old *LdapGroup) error {
+	spec := field.NewPath("spec")
+	var errs field.ErrorList
+	errs = append(errs, validateName(spec.Child("name"), r.Spec.Name)...)
+	errs = append(errs, validateID(spec.Child("gid"), r.Spec.GID)...)
+	errs = append(errs, validateObjectName(spec.Child("server"), r.Spec.Server)...)
+	errs = append(errs, validateObjectName(spec.Child("idPool"), r.Spec.IDPool)...)
+	errs = append(errs, validateOU(spec.Child("ou"), r.Spec.OU)...)
+	errs = append(errs, validateObjectClasses(spec.Child("extraObjectClasses"), r.Spec.ExtraObjectClasses)...)
+	errs = append(errs, validateAttributes(spec.Child("attributes"), r.Spec.Attributes, IsReservedGroupAttribute)...)
+
+	// members are either a uid or a username
+	seen := map[string]bool{}
+	for i, member := range r.Spec.Members {
+		fldPath := spec.Child("members").Index(i)
+		if _, err := strconv.ParseUint(member, 10, 64); err == nil {
+			errs = append(errs, validateID(fldPath, member)...)
+		} else {
+			errs = append(errs, validateName(fldPath, member)...)
+		}
+		if seen[member] {
+			errs = append(errs, field.Duplicate(fldPath, member))
+		}
+		seen[member] = true
+	}
+	if len(errs) == 0 && webhookClient != nil {
+		// moving to another LdapServer checks the new one
+		moved := old == nil || serverName(old.Spec.Server) != serverName(r.Spec.Server)
+		if moved || old.Spec.Name != r.Spec.Name {
+			errs = append(errs, r.uniqueGroup(spec.Child("name"), GroupNameField, r.Spec.Name)...)
+		}
+		if r.Spec.GID != "" && (moved || old.Spec.GID != r.Spec.GID) {
+			errs = append(errs, r.uniqueGroup(spec.Child("gid"), GIDField, r.Spec.GID)...)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("LdapGroup").GroupKind(), r.Name, errs)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IDRange is an inclusive range of uid or gid numbers
+type IDRange struct {
+	// +kubebuilder:validation:Minimum=0
+	Start int64 `json:"start"`
+	// +kubebuilder:validation:Maximum=4294967294
+	End int64 `json:"end"`
+}
+
+// Contains tells whether id is part of the range
+func (r IDRange) Contains(id int64) bool {
+	return id >= r.Start && id <= r.End
+}
+
+// LdapIDPoolSpec defines the numbers handed out to users and groups that
+// leave their uid or gid empty
+type LdapIDPoolSpec struct {
+	// UIDs are allocated to users
+	UIDs *IDRange `json:"uids,omitempty"`
+	// GIDs are allocated to groups and to users without a gid
+	GIDs *IDRange `json:"gids,omitempty"`
+}
+
+// LdapIDPoolStatus defines the observed state of LdapIDPool
+type LdapIDPoolStatus struct {
+	// NextUID is where the search for a free uid starts, it wraps around
+	// to the start of the range once the end is reached
+	NextUID int64 `json:"nextUID,omitempty"`
+	// NextGID is where the search for a free gid starts
+	NextGID int64 `json:"nextGID,omitempty"`
+	// LastUID is the uid last allocated and who got it
+	LastUID *IDAllocation `json:"lastUID,omitempty"`
+	// LastGID is the gid last allocated and who got it
+	LastGID *IDAllocation `json:"lastGID,omitempty"`
+}
+
+// IDAllocation records a number handed out by the pool
+type IDAllocation struct {
+	ID int64 `json:"id"`
+	// Owner is the kind, namespace and name of the object, for example
+	// LdapUser/default/user01
+	Owner string      `json:"owner"`
+	Time  metav1.Time `json:"time"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="UID Start",type=integer,JSONPath=`.spec.uids.start`
+// +kubebuilder:printcolumn:name="UID End",type=integer,JSONPath=`.spec.uids.end`
+// +kubebuilder:printcolumn:name="Next UID",type=integer,JSONPath=`.status.nextUID`
+// +kubebuilder:printcolumn:name="GID Start",type=integer,JSONPath=`.spec.gids.start`
+// +kubebuilder:printcolumn:name="GID End",type=integer,JSONPath=`.spec.gids.end`
+// +kubebuilder:printcolumn:name="Next GID",type=integer,JSONPath=`.status.nextGID`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// LdapIDPool is the Schema for the ldapidpools API
+type LdapIDPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LdapIDPoolSpec   `json:"spec,omitempty"`
+	Status LdapIDPoolStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// LdapIDPoolList contains a list of LdapIDPool
+type LdapIDPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LdapIDPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LdapIDPool{}, &LdapIDPoolList{})
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecretKeyReference selects a key of a Secret in a given namespace
+type SecretKeyReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+}
+
+// LdapServerTLS defines how the connection to the LDAP server is secured
+type LdapServerTLS struct {
+	// Enabled connects with implicit TLS (LDAPS, port 636 by default)
+	Enabled bool `json:"enabled,omitempty"`
+	// StartTLS upgrades a plain connection (port 389 by default) instead
+	StartTLS           bool `json:"startTLS,omitempty"`
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// SecretRef points to a Secret holding the CA bundle used to verify the
+	// server (ca.crt) and optionally a client certificate (tls.crt and
+	// tls.key)
+	SecretRef *corev1.SecretReference `json:"secretRef,omitempty"`
+}
+
+// LdapServerSpec defines the desired state of LdapServer
+type LdapServerSpec struct {
+	Host string `json:"host"`
+	// Port defaults to 389, or 636 for LDAPS
+	Port                  int32              `json:"port,omitempty"`
+	BaseDN                string             `json:"baseDN"`
+	BindDN                string             `json:"bindDN"`
+	BindPasswordSecretRef SecretKeyReference `json:"bindPasswordSecretRef"`
+	TLS                   *LdapServerTLS     `json:"tls,omitempty"`
+	// PasswordScheme is used to hash userPassword before it is written,
+	// defaults to SSHA. Passwords already carrying a {SCHEME} prefix are
+	// written unchanged.
+	// +kubebuilder:validation:Enum=SSHA;SSHA512;CRYPT;ARGON2
+	PasswordScheme string `json:"passwordScheme,omitempty"`
+	// UserDNTemplate is the Go template for the DN of new users, defaults
+	// to "uid={{.Name}},{{.OU}},{{.BaseDN}}". Existing entries are moved
+	// when their DN doesn't match.
+	UserDNTemplate string `json:"userDNTemplate,omitempty"`
+	// GroupDNTemplate is the Go template for the DN of new groups, defaults
+	// to "cn={{.Name}},{{.OU}},{{.BaseDN}}"
+	GroupDNTemplate string `json:"groupDNTemplate,omitempty"`
+	// UserOU fills {{.OU}} for users that don't set one, defaults to
+	// "ou=People"
+	UserOU string `json:"userOU,omitempty"`
+	// GroupOU fills {{.OU}} for groups that don't set one, defaults to
+	// "ou=Groups"
+	GroupOU string `json:"groupOU,omitempty"`
+	// GroupSchema is used by groups that don't set their own, defaults to
+	// RFC2307
+	GroupSchema *GroupSchema `json:"groupSchema,omitempty"`
+	// DeletionPolicy is used by users and groups that don't set their own,
+	// defaults to Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// LdapServerStatus defines the observed state of LdapServer
+type LdapServerStatus struct {
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.host`
+// +kubebuilder:printcolumn:name="Port",type=integer,JSONPath=`.spec.port`
+// +kubebuilder:printcolumn:name="Base DN",type=string,JSONPath=`.spec.baseDN`
+// +kubebuilder:printcolumn:name="Bind DN",type=string,JSONPath=`.spec.bindDN`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// LdapServer is the Schema for the ldapservers API
+type LdapServer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LdapServerSpec   `json:"spec,omitempty"`
+	Status LdapServerStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// LdapServerList contains a list of LdapServer
+type LdapServerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LdapServer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LdapServer{}, &LdapServerList{})
+}
@@ -17,29 +17,125 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// ExpiryDateFormat is the layout of LdapUserSpec.ExpiresOn
+const ExpiryDateFormat = "2006-01-02"
+
 // LdapUserSpec defines the desired state of LdapUser
 type LdapUserSpec struct {
 	Username string `json:"username"`
-	UID      string `json:"uid"`
-	GID      string `json:"gid"`
-	Password string `json:"password"`
-	Homedir  string `json:"homedir,omitempty"`
-	Shell    string `json:"shell,omitempty"`
+	// UID and GID are allocated from the IDPool when left empty
+	UID string `json:"uid,omitempty"`
+	GID string `json:"gid,omitempty"`
+	// Password is stored in clear in the object.
+	// Deprecated: use PasswordSecretRef, inline passwords are moved to a
+	// Secret by the controller.
+	Password string `json:"password,omitempty"`
+	// PasswordSecretRef selects the key of a Secret in the same namespace
+	// holding the password
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+	Homedir           string                    `json:"homedir,omitempty"`
+	Shell             string                    `json:"shell,omitempty"`
+	// Gecos is written to the gecos attribute, defaults to the username
+	Gecos string `json:"gecos,omitempty"`
+	// Server is the name of the LdapServer to use, defaults to the
+	// manager's --ldap-server
+	Server string `json:"server,omitempty"`
+	// IDPool is the LdapIDPool numbers are allocated from, defaults to the
+	// manager's --id-pool
+	IDPool string `json:"idPool,omitempty"`
+	// OU is the part of the DN between the entry and the base DN, for example
+	// "ou=People". Defaults to the server's setting.
+	OU string `json:"ou,omitempty"`
+	// ExpiresOn is the day the account expires, as YYYY-MM-DD, written to
+	// shadowExpire
+	ExpiresOn string `json:"expiresOn,omitempty"`
+	// PasswordMaxAge is the number of days a password stays valid, written
+	// to shadowMax
+	// +kubebuilder:validation:Minimum=0
+	PasswordMaxAge *int64 `json:"passwordMaxAge,omitempty"`
+	// PasswordMinAge is the number of days before a password can be changed
+	// again, written to shadowMin
+	// +kubebuilder:validation:Minimum=0
+	PasswordMinAge *int64 `json:"passwordMinAge,omitempty"`
+	// PasswordWarningDays is how many days before the password expires the
+	// user is warned, written to shadowWarning
+	// +kubebuilder:validation:Minimum=0
+	PasswordWarningDays *int64 `json:"passwordWarningDays,omitempty"`
+	// PasswordInactiveDays is how many days after the password expired it
+	// can still be changed before the account is locked, written to
+	// shadowInactive
+	// +kubebuilder:validation:Minimum=0
+	PasswordInactiveDays *int64 `json:"passwordInactiveDays,omitempty"`
+	// SSHPublicKeys are written to sshPublicKey, one authorized_keys line
+	// each
+	SSHPublicKeys []string `json:"sshPublicKeys,omitempty"`
+	// SSHPublicKeysFrom adds the keys held in Secrets or ConfigMaps of the
+	// same namespace, in authorized_keys format
+	SSHPublicKeysFrom []SSHPublicKeySource `json:"sshPublicKeysFrom,omitempty"`
+	// ExtraObjectClasses are added to the entry along with the ones the
+	// controller needs, they are never removed. They must be auxiliary.
+	ExtraObjectClasses []string `json:"extraObjectClasses,omitempty"`
+	// Attributes are written to the entry as they are, an empty list
+	// removes the attribute. The attributes written by the controller and
+	// userPassword can't be set.
+	Attributes map[string][]string `json:"attributes,omitempty"`
+	// DriftPolicy is applied when the entry is found changed in LDAP on a
+	// resync, defaults to Repair
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+	// DeletionPolicy is applied to the entry when the object is deleted,
+	// defaults to the server's deletionPolicy
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// SSHPublicKeySource selects a key of a Secret or of a ConfigMap, only one
+// of them may be set
+type SSHPublicKeySource struct {
+	SecretKeyRef    *corev1.SecretKeySelector    `json:"secretKeyRef,omitempty"`
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
 }
 
 // LdapUserStatus defines the observed state of LdapUser
 type LdapUserStatus struct {
 	CreatedOn string `json:"createdOn,omitempty"`
 	UpdatedOn string `json:"updatedOn,omitempty"`
+	// ObservedGeneration is the generation last reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// DN of the entry in LDAP
+	DN         string      `json:"dn,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	// Drift lists the attributes found changed in LDAP on the last resync,
+	// or "entry" when the entry was missing
+	Drift []string `json:"drift,omitempty"`
+	// PasswordSecretVersion is the resourceVersion of the password Secret
+	// last applied
+	PasswordSecretVersion string `json:"passwordSecretVersion,omitempty"`
+	// Managed is set once the controller created or adopted the entry, it
+	// never writes to an existing entry it doesn't manage
+	Managed bool `json:"managed,omitempty"`
+	// Expiry is when the account expires, from spec.expiresOn
+	Expiry *metav1.Time `json:"expiry,omitempty"`
+	// DaysRemaining is the number of days left before the account expires,
+	// negative once it has
+	DaysRemaining *int64 `json:"daysRemaining,omitempty"`
+	// SSHKeyFingerprints are the SHA256 fingerprints of the keys written to
+	// sshPublicKey
+	SSHKeyFingerprints []string `json:"sshKeyFingerprints,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+// +kubebuilder:printcolumn:name="DN",type=string,JSONPath=`.status.dn`
+// +kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.status.expiry`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // LdapUser is the Schema for the ldapusers API
 type LdapUser struct {
@@ -0,0 +1,188 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"path"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var ldapuserlog = logf.Log.WithName("ldapuser-resource")
+
+func (r *LdapUser) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	webhookClient = mgr.GetClient()
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// LdapUserDefaults are the values filled in by the defaulting webhook
+// +kubebuilder:object:generate=false
+type LdapUserDefaults struct {
+	// HomeBase is the directory home directories are created in
+	HomeBase string
+	Shell    string
+}
+
+// UserDefaults is set by the manager from its flags
+var UserDefaults = LdapUserDefaults{
+	HomeBase: "/home",
+	Shell:    "/bin/bash",
+}
+
+// +kubebuilder:webhook:path=/mutate-ldap-digitalis-io-v1-ldapuser,mutating=true,failurePolicy=fail,groups=ldap.digitalis.io,resources=ldapusers,verbs=create;update,versions=v1,name=mldapuser.kb.io
+
+var _ webhook.Defaulter = &LdapUser{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type.
+// Only empty fields are filled in, so the values stay stable once stored.
+func (r *LdapUser) Default() {
+	ldapuserlog.Info("default", "name", r.Name)
+
+	if r.Spec.Username == "" {
+		return
+	}
+	defaulted := map[string]bool{}
+	for _, name := range strings.Split(r.Annotations[DefaultedAnnotation], ",") {
+		defaulted[name] = true
+	}
+	var names []string
+	for _, d := range r.Spec.defaults() {
+		switch {
+		// adopted users get the missing fields from their entry instead
+		case *d.field == "" && d.value != "" && !adopting(r.Annotations):
+			*d.field = d.value
+		case *d.field == "" || *d.field != d.value || !defaulted[d.name]:
+			continue
+		}
+		names = append(names, d.name)
+	}
+
+	if len(names) == 0 {
+		delete(r.Annotations, DefaultedAnnotation)
+		return
+	}
+	if r.Annotations == nil {
+		r.Annotations = map[string]string{}
+	}
+	r.Annotations[DefaultedAnnotation] = strings.Join(names, ",")
+}
+
+// fieldDefault is a spec field filled in by the defaulting webhook
+type fieldDefault struct {
+	name  string
+	field *string
+	value string
+}
+
+// defaults returns the fields of the spec the defaulting webhook fills in
+func (s *LdapUserSpec) defaults() []fieldDefault {
+	var homedir string
+	if UserDefaults.HomeBase != "" {
+		homedir = path.Join(UserDefaults.HomeBase, s.Username)
+	}
+	return []fieldDefault{
+		{"homedir", &s.Homedir, homedir},
+		{"shell", &s.Shell, UserDefaults.Shell},
+		{"gecos", &s.Gecos, s.Username},
+	}
+}
+
+// SpecWithoutDefaults returns the spec with the fields listed in
+// DefaultedAnnotation cleared, so adopting an entry takes its values for them
+func (r *LdapUser) SpecWithoutDefaults() LdapUserSpec {
+	spec := *r.Spec.DeepCopy()
+	defaulted := strings.Split(r.Annotations[DefaultedAnnotation], ",")
+	for _, d := range spec.defaults() {
+		if containsFold(defaulted, d.name) && *d.field == d.value {
+			*d.field = ""
+		}
+	}
+	return spec
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-ldap-digitalis-io-v1-ldapuser,mutating=false,failurePolicy=fail,groups=ldap.digitalis.io,resources=ldapusers,versions=v1,name=vldapuser.kb.io
+
+var _ webhook.Validator = &LdapUser{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *LdapUser) ValidateCreate() error {
+	ldapuserlog.Info("validate create", "name", r.Name)
+	return r.validate(nil)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *LdapUser) ValidateUpdate(old runtime.Object) error {
+	ldapuserlog.Info("validate update", "name", r.Name)
+	// objects created before the webhook must still be able to drop their
+	// finalizer
+	if r.DeletionTimestamp != nil {
+		return nil
+	}
+	return r.validate(old.(*LdapUser))
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *LdapUser) ValidateDelete() error {
+	return nil
+}
+
+// validate checks the spec, and that the name and number aren't used by
+// another object when they are new
+func (r *LdapUser) validate(old *LdapUser) error {
+	spec := field.NewPath("spec")
+	var errs field.ErrorList
+	errs = append(errs, validateName(spec.Child("username"), r.Spec.Username)...)
+	errs = append(errs, validateID(spec.Child("uid"), r.Spec.UID)...)
+	errs = append(errs, validateID(spec.Child("gid"), r.Spec.GID)...)
+	errs = append(errs, validatePath(spec.Child("homedir"), r.Spec.Homedir)...)
+	errs = append(errs, validatePath(spec.Child("shell"), r.Spec.Shell)...)
+	errs = append(errs, validateGecos(spec.Child("gecos"), r.Spec.Gecos)...)
+	errs = append(errs, validateObjectName(spec.Child("server"), r.Spec.Server)...)
+	errs = append(errs, validateObjectName(spec.Child("idPool"), r.Spec.IDPool)...)
+	errs = append(errs, validateOU(spec.Child("ou"), r.Spec.OU)...)
+	errs = append(errs, validateDate(spec.Child("expiresOn"), r.Spec.ExpiresOn)...)
+	errs = append(errs, validateSSHKeys(spec.Child("sshPublicKeys"), r.Spec.SSHPublicKeys)...)
+	errs = append(errs, validateSSHKeySources(spec.Child("sshPublicKeysFrom"), r.Spec.SSHPublicKeysFrom)...)
+	errs = append(errs, validateObjectClasses(spec.Child("extraObjectClasses"), r.Spec.ExtraObjectClasses)...)
+	errs = append(errs, validateAttributes(spec.Child("attributes"), r.Spec.Attributes, IsReservedUserAttribute)...)
+	if ref := r.Spec.PasswordSecretRef; ref != nil {
+		errs = append(errs, validateKeyRef(spec.Child("passwordSecretRef"), ref.Name, ref.Key)...)
+	}
+	if len(errs) == 0 && webhookClient != nil {
+		// moving to another LdapServer checks the new one
+		moved := old == nil || serverName(old.Spec.Server) != serverName(r.Spec.Server)
+		if moved || old.Spec.Username != r.Spec.Username {
+			errs = append(errs, r.uniqueUser(spec.Child("username"), UsernameField, r.Spec.Username)...)
+		}
+		if r.Spec.UID != "" && (moved || old.Spec.UID != r.Spec.UID) {
+			errs = append(errs, r.uniqueUser(spec.Child("uid"), UIDField, r.Spec.UID)...)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("LdapUser").GroupKind(), r.Name, errs)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Field indexes registered by the controllers, the webhooks use them to
+// refuse duplicates
+const (
+	UsernameField  = ".spec.username"
+	UIDField       = ".spec.uid"
+	GroupNameField = ".spec.name"
+	GIDField       = ".spec.gid"
+)
+
+// webhookClient reads the other users and groups, it is set up along with
+// the webhooks
+var webhookClient client.Client
+
+// DefaultServer is the LdapServer of objects that don't set spec.server, set
+// by the manager from its flags
+var DefaultServer = "default"
+
+// serverName returns the LdapServer an object with the given spec.server
+// writes to
+func serverName(server string) string {
+	if server != "" {
+		return server
+	}
+	return DefaultServer
+}
+
+// uniqueUser checks no other LdapUser of the same LdapServer, in any
+// namespace, uses value for the indexed field
+func (r *LdapUser) uniqueUser(fldPath *field.Path, indexField string, value string) field.ErrorList {
+	var users LdapUserList
+	if err := webhookClient.List(context.Background(), &users, client.MatchingFields{indexField: value}); err != nil {
+		return field.ErrorList{field.InternalError(fldPath, err)}
+	}
+	for _, other := range users.Items {
+		if other.Namespace == r.Namespace && other.Name == r.Name || serverName(other.Spec.Server) != serverName(r.Spec.Server) {
+			continue
+		}
+		return field.ErrorList{field.Invalid(fldPath, value, fmt.Sprintf("already used by LdapUser %s/%s", other.Namespace, other.Name))}
+	}
+	return nil
+}
+
+// uniqueGroup checks no other LdapGroup of the same LdapServer, in any
+// namespace, uses value for the indexed field
+func (r *LdapGroup) uniqueGroup(fldPath *field.Path, indexField string, value string) field.ErrorList {
+	var groups LdapGroupList
+	if err := webhookClient.List(context.Background(), &groups, client.MatchingFields{indexField: value}); err != nil {
+		return field.ErrorList{field.InternalError(fldPath, err)}
+	}
+	for _, other := range groups.Items {
+		if other.Namespace == r.Namespace && other.Name == r.Name || serverName(other.Spec.Server) != serverName(r.Spec.Server) {
+			continue
+		}
+		return field.ErrorList{field.Invalid(fldPath, value, fmt.Sprintf("already used by LdapGroup %s/%s", other.Namespace, other.Name))}
+	}
+	return nil
+}
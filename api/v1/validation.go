@@ -0,0 +1,223 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// MaxID is the largest usable uid and gid, (uid_t)-1 is reserved
+const MaxID = 4294967294
+
+// maxNameLength is the longest user or group name most systems accept
+const maxNameLength = 32
+
+// attributeName matches the descr and numericoid forms of RFC 4512 used
+// for attribute types and objectClasses
+var attributeName = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9-]*|[0-9]+(\.[0-9]+)+)$`)
+
+// posixName follows the portable user and group name rules of useradd
+var posixName = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+
+func validateName(fldPath *field.Path, name string) field.ErrorList {
+	var errs field.ErrorList
+	switch {
+	case name == "":
+		errs = append(errs, field.Required(fldPath, ""))
+	case len(name) > maxNameLength:
+		errs = append(errs, field.TooLong(fldPath, name, maxNameLength))
+	case !posixName.MatchString(name):
+		errs = append(errs, field.Invalid(fldPath, name,
+			"must start with a lowercase letter or underscore, followed by lowercase letters, digits, underscores or dashes"))
+	}
+	return errs
+}
+
+// validateID checks an optional uid or gid, empty ones are allocated from
+// an LdapIDPool
+func validateID(fldPath *field.Path, id string) field.ErrorList {
+	var errs field.ErrorList
+	if id == "" {
+		return errs
+	}
+	if n, err := strconv.ParseUint(id, 10, 64); err != nil || n > MaxID {
+		errs = append(errs, field.Invalid(fldPath, id, "must be a number between 0 and "+strconv.Itoa(MaxID)))
+	}
+	return errs
+}
+
+// validatePath checks an optional passwd style path
+func validatePath(fldPath *field.Path, p string) field.ErrorList {
+	var errs field.ErrorList
+	switch {
+	case p == "":
+	case !path.IsAbs(p):
+		errs = append(errs, field.Invalid(fldPath, p, "must be an absolute path"))
+	case strings.ContainsAny(p, ":\n\x00"):
+		errs = append(errs, field.Invalid(fldPath, p, "must not contain ':' or control characters"))
+	}
+	return errs
+}
+
+// validateGecos checks the value fits the IA5String syntax of gecos
+func validateGecos(fldPath *field.Path, gecos string) field.ErrorList {
+	var errs field.ErrorList
+	for _, c := range gecos {
+		if c > 0x7e || c < 0x20 || c == ':' {
+			errs = append(errs, field.Invalid(fldPath, gecos, "must only contain printable ASCII characters other than ':'"))
+			break
+		}
+	}
+	return errs
+}
+
+// validateObjectName checks an optional reference to a cluster scoped
+// object such as an LdapServer
+func validateObjectName(fldPath *field.Path, name string) field.ErrorList {
+	var errs field.ErrorList
+	if name == "" {
+		return errs
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		errs = append(errs, field.Invalid(fldPath, name, msg))
+	}
+	return errs
+}
+
+func validateOU(fldPath *field.Path, ou string) field.ErrorList {
+	var errs field.ErrorList
+	if ou == "" {
+		return errs
+	}
+	if _, err := ldap.ParseDN(ou); err != nil {
+		errs = append(errs, field.Invalid(fldPath, ou, "must be a DN such as ou=People: "+err.Error()))
+	}
+	return errs
+}
+
+// validateDate checks an optional YYYY-MM-DD date
+func validateDate(fldPath *field.Path, date string) field.ErrorList {
+	var errs field.ErrorList
+	if date == "" {
+		return errs
+	}
+	if _, err := time.Parse(ExpiryDateFormat, date); err != nil {
+		errs = append(errs, field.Invalid(fldPath, date, "must be a date as YYYY-MM-DD"))
+	}
+	return errs
+}
+
+// validateSSHKeys checks each key is a single authorized_keys line
+func validateSSHKeys(fldPath *field.Path, keys []string) field.ErrorList {
+	var errs field.ErrorList
+	seen := map[string]bool{}
+	for i, key := range keys {
+		fingerprint, err := SSHKeyFingerprint(key)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(fldPath.Index(i), key, "must be an SSH public key in authorized_keys format: "+err.Error()))
+		case seen[fingerprint]:
+			errs = append(errs, field.Duplicate(fldPath.Index(i), key))
+		}
+		seen[fingerprint] = true
+	}
+	return errs
+}
+
+// validateSSHKeySources checks each source selects exactly one key of a
+// Secret or ConfigMap
+func validateSSHKeySources(fldPath *field.Path, sources []SSHPublicKeySource) field.ErrorList {
+	var errs field.ErrorList
+	for i, source := range sources {
+		idx := fldPath.Index(i)
+		switch {
+		case source.SecretKeyRef != nil && source.ConfigMapKeyRef != nil:
+			errs = append(errs, field.Forbidden(idx, "only one of secretKeyRef and configMapKeyRef may be set"))
+		case source.SecretKeyRef != nil:
+			errs = append(errs, validateKeyRef(idx.Child("secretKeyRef"), source.SecretKeyRef.Name, source.SecretKeyRef.Key)...)
+		case source.ConfigMapKeyRef != nil:
+			errs = append(errs, validateKeyRef(idx.Child("configMapKeyRef"), source.ConfigMapKeyRef.Name, source.ConfigMapKeyRef.Key)...)
+		default:
+			errs = append(errs, field.Required(idx, "one of secretKeyRef and configMapKeyRef must be set"))
+		}
+	}
+	return errs
+}
+
+func validateKeyRef(fldPath *field.Path, name string, key string) field.ErrorList {
+	var errs field.ErrorList
+	if name == "" {
+		errs = append(errs, field.Required(fldPath.Child("name"), ""))
+	}
+	if key == "" {
+		errs = append(errs, field.Required(fldPath.Child("key"), ""))
+	}
+	return errs
+}
+
+// validateObjectClasses checks the names of extra objectClasses and that
+// they are not structural
+func validateObjectClasses(fldPath *field.Path, objectClasses []string) field.ErrorList {
+	var errs field.ErrorList
+	for i, oc := range objectClasses {
+		switch {
+		case !attributeName.MatchString(oc):
+			errs = append(errs, field.Invalid(fldPath.Index(i), oc, "must be an objectClass name or OID"))
+		case containsFold(objectClasses[:i], oc):
+			errs = append(errs, field.Duplicate(fldPath.Index(i), oc))
+		case containsFold(structuralObjectClasses, oc):
+			errs = append(errs, field.Invalid(fldPath.Index(i), oc, "is a structural objectClass, only auxiliary ones can be added"))
+		}
+	}
+	return errs
+}
+
+// validateAttributes checks extra attributes have valid names, are not
+// written by the controller and have no empty values
+func validateAttributes(fldPath *field.Path, attrs map[string][]string, reserved func(string) bool) field.ErrorList {
+	var errs field.ErrorList
+	var names []string
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		switch {
+		case !attributeName.MatchString(name):
+			errs = append(errs, field.Invalid(fldPath.Key(name), name, "must be an attribute name or OID"))
+		case reserved(name):
+			errs = append(errs, field.Forbidden(fldPath.Key(name), "is written by the controller"))
+		case containsFold(names[:i], name):
+			errs = append(errs, field.Duplicate(fldPath.Key(name), name))
+		}
+		for j, value := range attrs[name] {
+			if value == "" {
+				errs = append(errs, field.Invalid(fldPath.Key(name).Index(j), value, "must not be empty, use an empty list to remove the attribute"))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testSSHKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIEyW7B4Lk8YA++Kq8BDzyEqLDIFDaenFVQ9RzBA9vX4l user01@example"
+
+func TestLdapUserValidate(t *testing.T) {
+	valid := LdapUserSpec{Username: "user01", UID: "1000", GID: "1000", Homedir: "/home/user01", Shell: "/bin/bash"}
+	tests := []struct {
+		name    string
+		mutate  func(*LdapUserSpec)
+		wantErr string
+	}{
+		{name: "valid", mutate: func(*LdapUserSpec) {}},
+		{name: "empty username", mutate: func(s *LdapUserSpec) { s.Username = "" }, wantErr: "spec.username: Required value"},
+		{name: "uppercase username", mutate: func(s *LdapUserSpec) { s.Username = "User01" }, wantErr: "spec.username: Invalid value"},
+		{name: "long username", mutate: func(s *LdapUserSpec) { s.Username = strings.Repeat("a", 33) }, wantErr: "spec.username: Too long"},
+		{name: "non numeric uid", mutate: func(s *LdapUserSpec) { s.UID = "abc" }, wantErr: "spec.uid: Invalid value"},
+		{name: "uid out of range", mutate: func(s *LdapUserSpec) { s.UID = "4294967295" }, wantErr: "spec.uid: Invalid value"},
+		{name: "relative homedir", mutate: func(s *LdapUserSpec) { s.Homedir = "home/user01" }, wantErr: "spec.homedir: Invalid value"},
+		{name: "shell with colon", mutate: func(s *LdapUserSpec) { s.Shell = "/bin/sh:x" }, wantErr: "spec.shell: Invalid value"},
+		{name: "non ascii gecos", mutate: func(s *LdapUserSpec) { s.Gecos = "Zoë" }, wantErr: "spec.gecos: Invalid value"},
+		{name: "expiry date", mutate: func(s *LdapUserSpec) { s.ExpiresOn = "2024-01-31" }},
+		{name: "bad expiry date", mutate: func(s *LdapUserSpec) { s.ExpiresOn = "31/01/2024" }, wantErr: "spec.expiresOn: Invalid value"},
+		{name: "ssh key", mutate: func(s *LdapUserSpec) { s.SSHPublicKeys = []string{testSSHKey} }},
+		{name: "bad ssh key", mutate: func(s *LdapUserSpec) { s.SSHPublicKeys = []string{"ssh-rsa AAAA"} }, wantErr: "spec.sshPublicKeys[0]: Invalid value"},
+		{name: "duplicate ssh key", mutate: func(s *LdapUserSpec) { s.SSHPublicKeys = []string{testSSHKey, testSSHKey} }, wantErr: "spec.sshPublicKeys[1]: Duplicate value"},
+		{name: "ssh key source without ref", mutate: func(s *LdapUserSpec) { s.SSHPublicKeysFrom = []SSHPublicKeySource{{}} }, wantErr: "spec.sshPublicKeysFrom[0]: Required value"},
+		{name: "extra attributes", mutate: func(s *LdapUserSpec) {
+			s.ExtraObjectClasses = []string{"extensibleObject"}
+			s.Attributes = map[string][]string{"mail": {"user01@example.com"}, "description": {"One"}, "telephoneNumber": {}}
+		}},
+		{name: "structural objectclass", mutate: func(s *LdapUserSpec) { s.ExtraObjectClasses = []string{"InetOrgPerson"} }, wantErr: "spec.extraObjectClasses[0]: Invalid value"},
+		{name: "bad objectclass", mutate: func(s *LdapUserSpec) { s.ExtraObjectClasses = []string{"inet OrgPerson"} }, wantErr: "spec.extraObjectClasses[0]: Invalid value"},
+		{name: "reserved attribute", mutate: func(s *LdapUserSpec) { s.Attributes = map[string][]string{"UserPassword": {"x"}} }, wantErr: "spec.attributes[UserPassword]: Forbidden"},
+		{name: "empty attribute value", mutate: func(s *LdapUserSpec) { s.Attributes = map[string][]string{"mail": {""}} }, wantErr: "spec.attributes[mail][0]: Invalid value"},
+		{name: "bad ou", mutate: func(s *LdapUserSpec) { s.OU = "People" }, wantErr: "spec.ou: Invalid value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &LdapUser{ObjectMeta: metav1.ObjectMeta{Name: "user01"}, Spec: valid}
+			tt.mutate(&user.Spec)
+			checkValidation(t, user.ValidateCreate(), tt.wantErr)
+		})
+	}
+}
+
+func TestLdapUserDefault(t *testing.T) {
+	user := &LdapUser{Spec: LdapUserSpec{Username: "user01", Shell: "/bin/zsh"}}
+	user.Default()
+	if user.Spec.Homedir != "/home/user01" || user.Spec.Shell != "/bin/zsh" || user.Spec.Gecos != "user01" {
+		t.Errorf("Default() = %+v", user.Spec)
+	}
+	if got := user.Annotations[DefaultedAnnotation]; got != "homedir,gecos" {
+		t.Errorf("defaulted = %q, want homedir,gecos", got)
+	}
+
+	// fields changed since are no longer defaults
+	user.Spec.Gecos = "User One"
+	user.Default()
+	if got := user.Annotations[DefaultedAnnotation]; got != "homedir" {
+		t.Errorf("defaulted = %q, want homedir", got)
+	}
+	if spec := user.SpecWithoutDefaults(); spec.Homedir != "" || spec.Shell != "/bin/zsh" || spec.Gecos != "User One" {
+		t.Errorf("SpecWithoutDefaults() = %+v", spec)
+	}
+
+	// adopted users take the missing fields from their entry
+	adopted := &LdapUser{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AdoptAnnotation: "true"}},
+		Spec:       LdapUserSpec{Username: "user01"},
+	}
+	adopted.Default()
+	if adopted.Spec.Homedir != "" || adopted.Spec.Shell != "" || adopted.Spec.Gecos != "" || adopted.Annotations[DefaultedAnnotation] != "" {
+		t.Errorf("Default() of an adopted user = %+v", adopted)
+	}
+}
+
+func TestSSHKeyFingerprint(t *testing.T) {
+	if got, err := SSHKeyFingerprint(testSSHKey); err != nil || got != "SHA256:RT8Akub2oXLNEbgc1X2khw5BZZnoLfd7Nua0kHX1+h4" {
+		t.Errorf("SSHKeyFingerprint() = %s, %v", got, err)
+	}
+	if _, err := SSHKeyFingerprint(testSSHKey + "\n" + testSSHKey); err == nil {
+		t.Error("SSHKeyFingerprint() accepted two lines")
+	}
+}
+
+func TestLdapGroupValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    LdapGroupSpec
+		wantErr string
+	}{
+		{name: "valid", spec: LdapGroupSpec{Name: "admins", GID: "2000", Members: []string{"user01", "1001"}}},
+		{name: "bad member", spec: LdapGroupSpec{Name: "admins", GID: "2000", Members: []string{"User 01"}}, wantErr: "spec.members[0]: Invalid value"},
+		{name: "duplicate member", spec: LdapGroupSpec{Name: "admins", GID: "2000", Members: []string{"user01", "user01"}}, wantErr: "spec.members[1]: Duplicate value"},
+		{name: "allocated gid", spec: LdapGroupSpec{Name: "admins"}},
+		{name: "extra attributes", spec: LdapGroupSpec{Name: "admins", ExtraObjectClasses: []string{"extensibleObject"}, Attributes: map[string][]string{"description": {"Admins"}}}},
+		{name: "reserved attribute", spec: LdapGroupSpec{Name: "admins", Attributes: map[string][]string{"memberUid": {"root"}}}, wantErr: "spec.attributes[memberUid]: Forbidden"},
+		{name: "negative gid", spec: LdapGroupSpec{Name: "admins", GID: "-1"}, wantErr: "spec.gid: Invalid value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := &LdapGroup{ObjectMeta: metav1.ObjectMeta{Name: "admins"}, Spec: tt.spec}
+			checkValidation(t, group.ValidateCreate(), tt.wantErr)
+		})
+	}
+}
+
+func TestLdapUserUniquePerServer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	existing := &LdapUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "user01", Namespace: "other"},
+		Spec:       LdapUserSpec{Username: "user01", UID: "1000", GID: "1000"},
+	}
+	webhookClient = fake.NewFakeClientWithScheme(scheme, existing)
+	defer func() { webhookClient = nil }()
+
+	user := &LdapUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "user01", Namespace: "default"},
+		Spec:       LdapUserSpec{Username: "user01", UID: "1000", GID: "1000", Server: "other-ldap"},
+	}
+	checkValidation(t, user.ValidateCreate(), "")
+
+	moved := user.DeepCopy()
+	moved.Spec.Server = DefaultServer
+	checkValidation(t, moved.ValidateUpdate(user), "already used by LdapUser other/user01")
+}
+
+func checkValidation(t *testing.T, err error, wantErr string) {
+	t.Helper()
+	if wantErr == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Fatalf("error = %v, want %q", err, wantErr)
+	}
+}
@@ -21,16 +21,79 @@ limitations under the License.
 package v1
 
 import (
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupSchema) DeepCopyInto(out *GroupSchema) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupSchema.
+func (in *GroupSchema) DeepCopy() *GroupSchema {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupSchema)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IDAllocation) DeepCopyInto(out *IDAllocation) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IDAllocation.
+func (in *IDAllocation) DeepCopy() *IDAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(IDAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IDRange) DeepCopyInto(out *IDRange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IDRange.
+func (in *IDRange) DeepCopy() *IDRange {
+	if in == nil {
+		return nil
+	}
+	out := new(IDRange)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LdapGroup) DeepCopyInto(out *LdapGroup) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapGroup.
@@ -91,6 +154,31 @@ func (in *LdapGroupSpec) DeepCopyInto(out *LdapGroupSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Schema != nil {
+		in, out := &in.Schema, &out.Schema
+		*out = new(GroupSchema)
+		**out = **in
+	}
+	if in.ExtraObjectClasses != nil {
+		in, out := &in.ExtraObjectClasses, &out.ExtraObjectClasses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Attributes != nil {
+		in, out := &in.Attributes, &out.Attributes
+		*out = make(map[string][]string, len(*in))
+		for key, val := range *in {
+			var outVal []string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapGroupSpec.
@@ -106,6 +194,28 @@ func (in *LdapGroupSpec) DeepCopy() *LdapGroupSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LdapGroupStatus) DeepCopyInto(out *LdapGroupStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ResolvedMembers != nil {
+		in, out := &in.ResolvedMembers, &out.ResolvedMembers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MissingMembers != nil {
+		in, out := &in.MissingMembers, &out.MissingMembers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapGroupStatus.
@@ -119,14 +229,243 @@ func (in *LdapGroupStatus) DeepCopy() *LdapGroupStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *LdapUser) DeepCopyInto(out *LdapUser) {
+func (in *LdapIDPool) DeepCopyInto(out *LdapIDPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapIDPool.
+func (in *LdapIDPool) DeepCopy() *LdapIDPool {
+	if in == nil {
+		return nil
+	}
+	out := new(LdapIDPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LdapIDPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LdapIDPoolList) DeepCopyInto(out *LdapIDPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LdapIDPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapIDPoolList.
+func (in *LdapIDPoolList) DeepCopy() *LdapIDPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(LdapIDPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LdapIDPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LdapIDPoolSpec) DeepCopyInto(out *LdapIDPoolSpec) {
+	*out = *in
+	if in.UIDs != nil {
+		in, out := &in.UIDs, &out.UIDs
+		*out = new(IDRange)
+		**out = **in
+	}
+	if in.GIDs != nil {
+		in, out := &in.GIDs, &out.GIDs
+		*out = new(IDRange)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapIDPoolSpec.
+func (in *LdapIDPoolSpec) DeepCopy() *LdapIDPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LdapIDPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LdapIDPoolStatus) DeepCopyInto(out *LdapIDPoolStatus) {
+	*out = *in
+	if in.LastUID != nil {
+		in, out := &in.LastUID, &out.LastUID
+		*out = new(IDAllocation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastGID != nil {
+		in, out := &in.LastGID, &out.LastGID
+		*out = new(IDAllocation)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapIDPoolStatus.
+func (in *LdapIDPoolStatus) DeepCopy() *LdapIDPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LdapIDPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LdapServer) DeepCopyInto(out *LdapServer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	out.Status = in.Status
 }
 
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapServer.
+func (in *LdapServer) DeepCopy() *LdapServer {
+	if in == nil {
+		return nil
+	}
+	out := new(LdapServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LdapServer) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LdapServerList) DeepCopyInto(out *LdapServerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LdapServer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapServerList.
+func (in *LdapServerList) DeepCopy() *LdapServerList {
+	if in == nil {
+		return nil
+	}
+	out := new(LdapServerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LdapServerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LdapServerSpec) DeepCopyInto(out *LdapServerSpec) {
+	*out = *in
+	out.BindPasswordSecretRef = in.BindPasswordSecretRef
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(LdapServerTLS)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GroupSchema != nil {
+		in, out := &in.GroupSchema, &out.GroupSchema
+		*out = new(GroupSchema)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapServerSpec.
+func (in *LdapServerSpec) DeepCopy() *LdapServerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LdapServerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LdapServerStatus) DeepCopyInto(out *LdapServerStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapServerStatus.
+func (in *LdapServerStatus) DeepCopy() *LdapServerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LdapServerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LdapServerTLS) DeepCopyInto(out *LdapServerTLS) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(corev1.SecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapServerTLS.
+func (in *LdapServerTLS) DeepCopy() *LdapServerTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(LdapServerTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LdapUser) DeepCopyInto(out *LdapUser) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapUser.
 func (in *LdapUser) DeepCopy() *LdapUser {
 	if in == nil {
@@ -180,6 +519,63 @@ func (in *LdapUserList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LdapUserSpec) DeepCopyInto(out *LdapUserSpec) {
 	*out = *in
+	if in.PasswordSecretRef != nil {
+		in, out := &in.PasswordSecretRef, &out.PasswordSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PasswordMaxAge != nil {
+		in, out := &in.PasswordMaxAge, &out.PasswordMaxAge
+		*out = new(int64)
+		**out = **in
+	}
+	if in.PasswordMinAge != nil {
+		in, out := &in.PasswordMinAge, &out.PasswordMinAge
+		*out = new(int64)
+		**out = **in
+	}
+	if in.PasswordWarningDays != nil {
+		in, out := &in.PasswordWarningDays, &out.PasswordWarningDays
+		*out = new(int64)
+		**out = **in
+	}
+	if in.PasswordInactiveDays != nil {
+		in, out := &in.PasswordInactiveDays, &out.PasswordInactiveDays
+		*out = new(int64)
+		**out = **in
+	}
+	if in.SSHPublicKeys != nil {
+		in, out := &in.SSHPublicKeys, &out.SSHPublicKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SSHPublicKeysFrom != nil {
+		in, out := &in.SSHPublicKeysFrom, &out.SSHPublicKeysFrom
+		*out = make([]SSHPublicKeySource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ExtraObjectClasses != nil {
+		in, out := &in.ExtraObjectClasses, &out.ExtraObjectClasses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Attributes != nil {
+		in, out := &in.Attributes, &out.Attributes
+		*out = make(map[string][]string, len(*in))
+		for key, val := range *in {
+			var outVal []string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapUserSpec.
@@ -195,6 +591,32 @@ func (in *LdapUserSpec) DeepCopy() *LdapUserSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LdapUserStatus) DeepCopyInto(out *LdapUserStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Expiry != nil {
+		in, out := &in.Expiry, &out.Expiry
+		*out = (*in).DeepCopy()
+	}
+	if in.DaysRemaining != nil {
+		in, out := &in.DaysRemaining, &out.DaysRemaining
+		*out = new(int64)
+		**out = **in
+	}
+	if in.SSHKeyFingerprints != nil {
+		in, out := &in.SSHKeyFingerprints, &out.SSHKeyFingerprints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LdapUserStatus.
@@ -206,3 +628,43 @@ func (in *LdapUserStatus) DeepCopy() *LdapUserStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHPublicKeySource) DeepCopyInto(out *SSHPublicKeySource) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHPublicKeySource.
+func (in *SSHPublicKeySource) DeepCopy() *SSHPublicKeySource {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHPublicKeySource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyReference) DeepCopyInto(out *SecretKeyReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyReference.
+func (in *SecretKeyReference) DeepCopy() *SecretKeyReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyReference)
+	in.DeepCopyInto(out)
+	return out
+}
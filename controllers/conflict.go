@@ -0,0 +1,134 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+	ld "ldap-accounts-controller/ldap"
+)
+
+// conflictError is returned when a name or number is already taken
+type conflictError struct {
+	msg string
+}
+
+func (e *conflictError) Error() string {
+	return e.msg
+}
+
+// conflictRequeue is how soon a conflicted object is checked again, the
+// resync interval when there is one
+func conflictRequeue(resync time.Duration) time.Duration {
+	if resync > 0 {
+		return resync
+	}
+	return time.Minute
+}
+
+// precedes decides which of two objects using the same name or number keeps
+// it: the oldest, or the first by namespace and name when created together
+func precedes(a metav1.Object, b metav1.Object) bool {
+	at, bt := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+	if !at.Equal(&bt) {
+		return at.Before(&bt)
+	}
+	if a.GetNamespace() != b.GetNamespace() {
+		return a.GetNamespace() < b.GetNamespace()
+	}
+	return a.GetName() < b.GetName()
+}
+
+// userConflict checks that no older LdapUser of the same LdapServer, and no
+// other account in LDAP, uses the user's username or uid
+func userConflict(ctx context.Context, c client.Client, ldc *ld.Client, ldapuser *ldapv1.LdapUser, defaultServer string) error {
+	server := ldapServerName(ldapuser.Spec.Server, defaultServer)
+	for _, index := range []struct {
+		field string
+		name  string
+		value string
+	}{
+		{ldapv1.UsernameField, "username", ldapuser.Spec.Username},
+		{ldapv1.UIDField, "uid", ldapuser.Spec.UID},
+	} {
+		var users ldapv1.LdapUserList
+		if err := c.List(ctx, &users, client.MatchingFields{index.field: index.value}); err != nil {
+			return err
+		}
+		for i := range users.Items {
+			other := &users.Items[i]
+			if other.UID == ldapuser.UID || ldapServerName(other.Spec.Server, defaultServer) != server {
+				continue
+			}
+			if precedes(other, ldapuser) {
+				return &conflictError{fmt.Sprintf("%s %s is already used by LdapUser %s/%s", index.name, index.value, other.Namespace, other.Name)}
+			}
+		}
+	}
+
+	dn, err := ldc.UIDNumberOwner(ldapuser.Spec.UID, ldapuser.Spec.Username)
+	if err != nil {
+		return err
+	}
+	if dn != "" {
+		return &conflictError{fmt.Sprintf("uid %s is already used by %s", ldapuser.Spec.UID, dn)}
+	}
+	return nil
+}
+
+// groupConflict checks that no older LdapGroup of the same LdapServer, and no
+// other group in LDAP, uses the group's name or gid
+func groupConflict(ctx context.Context, c client.Client, ldc *ld.Client, ldapgroup *ldapv1.LdapGroup, defaultServer string) error {
+	server := ldapServerName(ldapgroup.Spec.Server, defaultServer)
+	for _, index := range []struct {
+		field string
+		name  string
+		value string
+	}{
+		{ldapv1.GroupNameField, "name", ldapgroup.Spec.Name},
+		{ldapv1.GIDField, "gid", ldapgroup.Spec.GID},
+	} {
+		var groups ldapv1.LdapGroupList
+		if err := c.List(ctx, &groups, client.MatchingFields{index.field: index.value}); err != nil {
+			return err
+		}
+		for i := range groups.Items {
+			other := &groups.Items[i]
+			if other.UID == ldapgroup.UID || ldapServerName(other.Spec.Server, defaultServer) != server {
+				continue
+			}
+			if precedes(other, ldapgroup) {
+				return &conflictError{fmt.Sprintf("%s %s is already used by LdapGroup %s/%s", index.name, index.value, other.Namespace, other.Name)}
+			}
+		}
+	}
+
+	dn, err := ldc.GIDNumberOwner(ldapgroup.Spec.GID, ldapgroup.Spec.Name)
+	if err != nil {
+		return err
+	}
+	if dn != "" {
+		return &conflictError{fmt.Sprintf("gid %s is already used by %s", ldapgroup.Spec.GID, dn)}
+	}
+	return nil
+}
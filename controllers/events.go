@@ -0,0 +1,57 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	ldapv1 "ldap-accounts-controller/api/v1"
+	ld "ldap-accounts-controller/ldap"
+)
+
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reasons of the events recorded on users and groups
+const (
+	eventCreated         = "Created"
+	eventUpdated         = "Updated"
+	eventDeleted         = "Deleted"
+	eventRetained        = "Retained"
+	eventDisabled        = "Disabled"
+	eventAdopted         = "Adopted"
+	eventMembersResolved = "MembersResolved"
+	eventBindFailed      = "BindFailed"
+	eventSchemaViolation = "SchemaViolation"
+	eventMemberNotFound  = "MemberNotFound"
+)
+
+// deletionEvent is the reason recorded for each deletion policy
+var deletionEvent = map[ldapv1.DeletionPolicy]string{
+	ldapv1.DeletionPolicyDelete:  eventDeleted,
+	ldapv1.DeletionPolicyRetain:  eventRetained,
+	ldapv1.DeletionPolicyDisable: eventDisabled,
+}
+
+// warningReason returns the reason of the event recorded for a failed
+// reconcile, the condition's reason unless the error is more specific
+func warningReason(reason string, err error) string {
+	switch {
+	case ld.IsBindError(err):
+		return eventBindFailed
+	case ld.IsSchemaViolation(err):
+		return eventSchemaViolation
+	}
+	return reason
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+
+	ld "ldap-accounts-controller/ldap"
+)
+
+func TestWarningReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("Could not connect to ldap server %w", &ld.BindError{Err: errors.New("invalid credentials")}), eventBindFailed},
+		{ldap.NewError(ldap.LDAPResultObjectClassViolation, errors.New("missing member")), eventSchemaViolation},
+		{errors.New("timeout"), reasonLdapError},
+	}
+	for _, tt := range tests {
+		if got := warningReason(reasonLdapError, tt.err); got != tt.want {
+			t.Errorf("warningReason(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
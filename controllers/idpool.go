@@ -0,0 +1,142 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+	ld "ldap-accounts-controller/ldap"
+)
+
+// +kubebuilder:rbac:groups=ldap.digitalis.io,resources=ldapidpools,verbs=get;list;watch
+// +kubebuilder:rbac:groups=ldap.digitalis.io,resources=ldapidpools/status,verbs=get;update;patch
+
+// allocateID hands out the next free uid, or gid, of the pool. The pool
+// status is written before the number is used, so concurrent allocations
+// conflict on it and retry rather than picking the same number.
+func allocateID(ctx context.Context, c client.Client, ldc *ld.Client, poolName string, gid bool, owner string) (string, error) {
+	used, err := usedIDs(ctx, c, ldc, gid)
+	if err != nil {
+		return "", err
+	}
+
+	var id int64
+	err = retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		var pool ldapv1.LdapIDPool
+		if err := c.Get(ctx, types.NamespacedName{Name: poolName}, &pool); err != nil {
+			return fmt.Errorf("unable to fetch id pool %s: %s", poolName, err)
+		}
+
+		idRange, next, last := pool.Spec.UIDs, &pool.Status.NextUID, &pool.Status.LastUID
+		if gid {
+			idRange, next, last = pool.Spec.GIDs, &pool.Status.NextGID, &pool.Status.LastGID
+		}
+		if idRange == nil {
+			return fmt.Errorf("id pool %s has no %s range", poolName, idName(gid))
+		}
+
+		var ok bool
+		if id, ok = nextFreeID(*idRange, *next, used); !ok {
+			return fmt.Errorf("id pool %s has no free %s left", poolName, idName(gid))
+		}
+		*next = id + 1
+		*last = &ldapv1.IDAllocation{ID: id, Owner: owner, Time: metav1.Now()}
+		return c.Status().Update(ctx, &pool)
+	})
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+func idName(gid bool) string {
+	if gid {
+		return "gid"
+	}
+	return "uid"
+}
+
+// usedIDs collects the numbers taken by users or groups, both the ones
+// defined in the cluster and the ones already in LDAP
+func usedIDs(ctx context.Context, c client.Client, ldc *ld.Client, gid bool) (map[int64]bool, error) {
+	used := map[int64]bool{}
+	add := func(id string) {
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+			used[n] = true
+		}
+	}
+
+	var users ldapv1.LdapUserList
+	if err := c.List(ctx, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users.Items {
+		if gid {
+			add(user.Spec.GID)
+		} else {
+			add(user.Spec.UID)
+		}
+	}
+
+	var numbers []int64
+	var err error
+	if gid {
+		var groups ldapv1.LdapGroupList
+		if err := c.List(ctx, &groups); err != nil {
+			return nil, err
+		}
+		for _, group := range groups.Items {
+			add(group.Spec.GID)
+		}
+		numbers, err = ldc.GIDNumbers()
+	} else {
+		numbers, err = ldc.UIDNumbers()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range numbers {
+		used[n] = true
+	}
+	return used, nil
+}
+
+// nextFreeID returns the first number of the range from next on which isn't
+// used, wrapping around to the start of the range
+func nextFreeID(idRange ldapv1.IDRange, next int64, used map[int64]bool) (int64, bool) {
+	if !idRange.Contains(next) {
+		next = idRange.Start
+	}
+	for i := int64(0); i <= idRange.End-idRange.Start; i++ {
+		id := next + i
+		if id > idRange.End {
+			id -= idRange.End - idRange.Start + 1
+		}
+		if !used[id] {
+			return id, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+)
+
+func TestNextFreeID(t *testing.T) {
+	idRange := ldapv1.IDRange{Start: 100, End: 103}
+	tests := []struct {
+		name   string
+		next   int64
+		used   []int64
+		want   int64
+		wantOK bool
+	}{
+		{name: "first", next: 0, want: 100, wantOK: true},
+		{name: "skips used", next: 100, used: []int64{100, 101}, want: 102, wantOK: true},
+		{name: "wraps around", next: 103, used: []int64{103}, want: 100, wantOK: true},
+		{name: "full", next: 101, used: []int64{100, 101, 102, 103}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used := map[int64]bool{}
+			for _, id := range tt.used {
+				used[id] = true
+			}
+			got, ok := nextFreeID(idRange, tt.next, used)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("nextFreeID() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+var _ = Describe("LdapIDPool", func() {
+	ctx := context.Background()
+
+	It("allocates ids that are free both in the cluster and in LDAP", func() {
+		Expect(k8sClient.Create(ctx, &ldapv1.LdapIDPool{
+			ObjectMeta: metav1.ObjectMeta{Name: "default"},
+			Spec: ldapv1.LdapIDPoolSpec{
+				UIDs: &ldapv1.IDRange{Start: 5000, End: 5999},
+				GIDs: &ldapv1.IDRange{Start: 5000, End: 5999},
+			},
+		})).To(Succeed())
+
+		// created by hand, not by the controller
+		add := ldap.NewAddRequest("uid=legacy,ou=People,"+testBaseDN, nil)
+		add.Attribute("objectClass", []string{"posixAccount"})
+		add.Attribute("uid", []string{"legacy"})
+		add.Attribute("uidNumber", []string{"5000"})
+		Expect(ldapServer.Dir.Add(add)).To(Succeed())
+
+		Expect(k8sClient.Create(ctx, &ldapv1.LdapUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "allocated", Namespace: "default"},
+			Spec:       ldapv1.LdapUserSpec{Username: "allocated", Homedir: "/home/allocated"},
+		})).To(Succeed())
+
+		Eventually(func() string {
+			var user ldapv1.LdapUser
+			_ = k8sClient.Get(ctx, types.NamespacedName{Name: "allocated", Namespace: "default"}, &user)
+			return user.Spec.UID + "/" + user.Spec.GID
+		}, testTimeout).Should(Equal("5001/5000"))
+
+		var pool ldapv1.LdapIDPool
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "default"}, &pool)).To(Succeed())
+		Expect(pool.Status.NextUID).To(Equal(int64(5002)))
+		Expect(pool.Status.LastUID.Owner).To(Equal("LdapUser/default/allocated"))
+	})
+})
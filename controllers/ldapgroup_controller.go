@@ -19,18 +19,27 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	ldapv1 "ldap-accounts-controller/api/v1"
-	ldap "ldap-accounts-controller/ldap"
+	ld "ldap-accounts-controller/ldap"
 )
 
 // LdapGroupReconciler reconciles a LdapGroup object
@@ -38,10 +47,25 @@ type LdapGroupReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// DefaultServer is the LdapServer used by objects that don't name one
+	DefaultServer string
+	// DefaultIDPool is the LdapIDPool used by objects that don't name one
+	DefaultIDPool string
+	// LdapClients is shared by the reconcilers so they reuse connections
+	LdapClients *ld.ClientCache
+	// Recorder records events on the objects
+	Recorder record.EventRecorder
+	// Directory, when set, is used instead of connecting to the LdapServer,
+	// for example a MemoryDirectory in tests
+	Directory ld.Directory
+	// ResyncInterval is how often the LDAP entry is checked for drift, zero
+	// disables it
+	ResyncInterval time.Duration
 }
 
 var (
-	ldapGroupOwnerKey = ".metadata.controller"
+	ldapGroupOwnerKey  = ".metadata.controller"
+	ldapGroupMemberKey = ".spec.members"
 )
 
 // +kubebuilder:rbac:groups=ldap.digitalis.io,resources=ldapgroups,verbs=get;list;watch;create;update;patch;delete
@@ -74,10 +98,29 @@ func (r *LdapGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	} else {
 		// The object is being deleted
 		if containsString(ldapgroup.GetFinalizers(), ldapgroupFinalizerName) {
-			// our finalizer is present, so lets handle any external dependency
-			if err := ldap.DeleteGroup(ldapgroup.Spec); err != nil {
-				log.Error(err, "Error deleting from LDAP")
-				return ctrl.Result{}, err
+			// our finalizer is present, so lets handle any external dependency,
+			// unless the entry belongs to someone else
+			if !isConflicted(ldapgroup.Status.Conditions) {
+				policy, ldc, err := removalClient(ctx, r, r.LdapClients, r.Directory, ldapgroup.Spec.DeletionPolicy, ldapServerName(ldapgroup.Spec.Server, r.DefaultServer))
+				switch {
+				case isServerNotFound(err):
+					// nothing can be done in LDAP anymore, don't keep the
+					// object around for it
+					log.Info("Leaving LDAP entry in place", "reason", err.Error())
+					r.Recorder.Eventf(&ldapgroup, corev1.EventTypeWarning, reasonServerUnavailable, "Left LDAP entry %s in place: %s", ldapgroup.Status.DN, err)
+				case err != nil:
+					log.Error(err, "unable to resolve ldap server")
+					return r.failed(ctx, &ldapgroup, metav1.ConditionUnknown, reasonServerUnavailable, err)
+				default:
+					if ldc != nil {
+						if _, err := ldc.RemoveGroup(ldapgroup.Spec); err != nil {
+							log.Error(err, "Error deleting from LDAP")
+							return r.failed(ctx, &ldapgroup, metav1.ConditionUnknown, reasonLdapError, err)
+						}
+					}
+					log.Info("Applied deletion policy", "policy", policy)
+					r.Recorder.Eventf(&ldapgroup, corev1.EventTypeNormal, deletionEvent[policy], "%s LDAP entry %s", deletionEvent[policy], ldapgroup.Status.DN)
+				}
 			}
 
 			// remove our finalizer from the list and update it.
@@ -92,26 +135,247 @@ func (r *LdapGroupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 	//! [finalizer]
 
+	ldc, err := ldapClient(ctx, r, r.LdapClients, r.Directory, ldapServerName(ldapgroup.Spec.Server, r.DefaultServer))
+	if err != nil {
+		log.Error(err, "unable to resolve ldap server")
+		return r.failed(ctx, &ldapgroup, metav1.ConditionUnknown, reasonServerUnavailable, err)
+	}
+
+	if !ownsEntry(ldapgroup.Status.Managed, ldapgroup.Status.DN, ldapgroup.Status.CreatedOn) {
+		adopted, exists, err := ldc.AdoptGroup(ldapgroup.Spec)
+		if err != nil {
+			log.Error(err, "unable to look up existing ldap group")
+			return r.failed(ctx, &ldapgroup, metav1.ConditionUnknown, reasonLdapError, err)
+		}
+		if exists {
+			if ldapgroup.Annotations[ldapv1.AdoptAnnotation] != "true" {
+				err := &conflictError{fmt.Sprintf("LDAP group %s already exists, set the %s annotation to adopt it", ldapgroup.Spec.Name, ldapv1.AdoptAnnotation)}
+				log.Info("Refusing to write LDAP group", "reason", err.Error())
+				return r.conflicted(ctx, &ldapgroup, err)
+			}
+			if !reflect.DeepEqual(adopted, ldapgroup.Spec) {
+				ldapgroup.Spec = adopted
+				if err := r.Update(ctx, &ldapgroup); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			log.Info("Adopted existing LDAP group")
+			r.Recorder.Eventf(&ldapgroup, corev1.EventTypeNormal, eventAdopted, "Adopted existing LDAP group %s", ldapgroup.Spec.Name)
+		}
+
+		// recorded before writing, so that the entry isn't taken for someone
+		// else's when the status can't be updated afterwards
+		ldapgroup.Status.Managed = true
+		if err := r.Status().Update(ctx, &ldapgroup); err != nil {
+			log.Error(err, "unable to update ldap group status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if ldapgroup.Spec.GID == "" {
+		pool := ldapgroup.Spec.IDPool
+		if pool == "" {
+			pool = r.DefaultIDPool
+		}
+		owner := fmt.Sprintf("LdapGroup/%s/%s", ldapgroup.Namespace, ldapgroup.Name)
+		if ldapgroup.Spec.GID, err = allocateID(ctx, r, ldc, pool, true, owner); err == nil {
+			err = r.Update(ctx, &ldapgroup)
+		}
+		if err != nil {
+			log.Error(err, "unable to allocate gid")
+			return r.failed(ctx, &ldapgroup, metav1.ConditionUnknown, reasonIDAllocation, err)
+		}
+		log.Info("Allocated gid", "gid", ldapgroup.Spec.GID)
+	}
+
+	if err := groupConflict(ctx, r, ldc, &ldapgroup, r.DefaultServer); err != nil {
+		if _, ok := err.(*conflictError); ok {
+			log.Info("Refusing to write LDAP group", "reason", err.Error())
+			return r.conflicted(ctx, &ldapgroup, err)
+		}
+		log.Error(err, "unable to check ldap group for conflicts")
+		return r.failed(ctx, &ldapgroup, metav1.ConditionUnknown, reasonLdapError, err)
+	}
+	setUnique(&ldapgroup.Status.Conditions, ldapgroup.Generation)
+
+	members, missing, err := ldc.GroupMembers(ldapgroup.Spec)
+	if err != nil {
+		log.Error(err, "unable to resolve ldap group members")
+		return r.failed(ctx, &ldapgroup, metav1.ConditionUnknown, reasonLdapError, err)
+	}
+	if len(missing) != 0 && !sameMembers(ldapgroup.Status.MissingMembers, missing) {
+		r.Recorder.Eventf(&ldapgroup, corev1.EventTypeWarning, eventMemberNotFound, "Members not found in LDAP: %s", strings.Join(missing, ", "))
+	}
+	ldapgroup.Status.MissingMembers = missing
+
+	var drift []string
+	// a member user that was added, changed or deleted is a change to apply,
+	// not drift
+	if isResync(ldapgroup.Status.Conditions, ldapgroup.Generation) && sameMembers(ldapgroup.Status.ResolvedMembers, members) {
+		var exists bool
+		if drift, exists, err = ldc.GroupDrift(ldapgroup.Spec); err != nil {
+			log.Error(err, "unable to check ldap group for drift")
+			return r.failed(ctx, &ldapgroup, metav1.ConditionUnknown, reasonLdapError, err)
+		}
+		if !exists {
+			drift = []string{driftEntry}
+		}
+		ldapgroup.Status.Drift = drift
+		if len(drift) == 0 {
+			setSynced(&ldapgroup.Status.Conditions, ldapgroup.Generation, nil)
+			return r.resynced(ctx, &ldapgroup)
+		}
+
+		log.Info("LDAP group was changed outside of the controller", "drift", drift)
+		if ldapgroup.Spec.DriftPolicy == ldapv1.DriftPolicyReport {
+			setDrifted(&ldapgroup.Status.Conditions, ldapgroup.Generation, drift)
+			return r.resynced(ctx, &ldapgroup)
+		}
+	} else {
+		ldapgroup.Status.Drift = nil
+	}
+
 	log.Info("Adding or updating LDAP group")
-	err := ldap.AddGroup(ldapgroup.Spec)
+	dn, changes, err := ldc.AddGroup(ldapgroup.Spec)
 	if err != nil {
 		log.Error(err, "cannot add group to ldap")
+		existing, lookupErr := ldc.GetGroup(ldapgroup.Spec.Name)
+		return r.failed(ctx, &ldapgroup, entryExists(existing.Name != "", lookupErr), reasonLdapError, err)
+	}
+	switch {
+	case containsString(changes, ld.EntryChange):
+		r.Recorder.Eventf(&ldapgroup, corev1.EventTypeNormal, eventCreated, "Created LDAP entry %s", dn)
+	case len(changes) != 0:
+		r.Recorder.Eventf(&ldapgroup, corev1.EventTypeNormal, eventUpdated, "Updated %s of LDAP entry %s", strings.Join(changes, ", "), dn)
+	}
+	if !sameMembers(ldapgroup.Status.ResolvedMembers, members) {
+		r.Recorder.Eventf(&ldapgroup, corev1.EventTypeNormal, eventMembersResolved, "Members: %s", strings.Join(members, ", "))
 	}
-	ldapgroup.Status.CreatedOn = time.Now().Format("2006-01-02 15:04:05")
 
-	var ldapGroups ldapv1.LdapGroupList
-	if err := r.List(ctx, &ldapGroups, client.InNamespace(req.Namespace), client.MatchingFields{ldapGroupOwnerKey: req.Name}); err != nil {
-		log.Error(err, "unable to list ldap accounts")
+	now := time.Now().Format(timeFormat)
+	if ldapgroup.Status.CreatedOn == "" {
+		ldapgroup.Status.CreatedOn = now
+	}
+	ldapgroup.Status.UpdatedOn = now
+	ldapgroup.Status.DN = dn
+	ldapgroup.Status.Managed = true
+	ldapgroup.Status.ResolvedMembers = members
+	setSynced(&ldapgroup.Status.Conditions, ldapgroup.Generation, drift)
+	return r.resynced(ctx, &ldapgroup)
+}
+
+// resynced writes the status and schedules the next drift check
+func (r *LdapGroupReconciler) resynced(ctx context.Context, ldapgroup *ldapv1.LdapGroup) (ctrl.Result, error) {
+	ldapgroup.Status.ObservedGeneration = ldapgroup.Generation
+	if err := r.Status().Update(ctx, ldapgroup); err != nil {
+		r.Log.Error(err, "unable to update ldap group status", "ldapgroup", ldapgroup.Name)
+		reconcileTotal.WithLabelValues("LdapGroup", resultFailure).Inc()
+		return ctrl.Result{}, err
+	}
+	reconcileTotal.WithLabelValues("LdapGroup", resultSuccess).Inc()
+	return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+}
+
+// failed records err in the status and returns it so the request is retried
+func (r *LdapGroupReconciler) failed(ctx context.Context, ldapgroup *ldapv1.LdapGroup, ready metav1.ConditionStatus, reason string, err error) (ctrl.Result, error) {
+	if isNewFailure(ldapgroup.Status.Conditions, reason, err) {
+		r.Recorder.Event(ldapgroup, corev1.EventTypeWarning, warningReason(reason, err), err.Error())
+	}
+	setFailed(&ldapgroup.Status.Conditions, ldapgroup.Generation, ready, reason, err)
+	ldapgroup.Status.ObservedGeneration = ldapgroup.Generation
+	if err := r.Status().Update(ctx, ldapgroup); err != nil {
+		r.Log.Error(err, "unable to update ldap group status", "ldapgroup", ldapgroup.Name)
+	}
+	reconcileTotal.WithLabelValues("LdapGroup", resultFailure).Inc()
+	return ctrl.Result{}, err
+}
+
+// conflicted records that the group clashes with another one and checks again
+// later, as the other one may go away
+func (r *LdapGroupReconciler) conflicted(ctx context.Context, ldapgroup *ldapv1.LdapGroup, err error) (ctrl.Result, error) {
+	setConflict(&ldapgroup.Status.Conditions, ldapgroup.Generation, err)
+	ldapgroup.Status.ObservedGeneration = ldapgroup.Generation
+	if err := r.Status().Update(ctx, ldapgroup); err != nil {
+		r.Log.Error(err, "unable to update ldap group status", "ldapgroup", ldapgroup.Name)
+		reconcileTotal.WithLabelValues("LdapGroup", resultFailure).Inc()
 		return ctrl.Result{}, err
 	}
+	reconcileTotal.WithLabelValues("LdapGroup", resultConflict).Inc()
+	return ctrl.Result{RequeueAfter: conflictRequeue(r.ResyncInterval)}, nil
+}
+
+// sameMembers compares the members in order
+func sameMembers(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
 
+// groupsForServer maps an LdapServer to the groups using it, so that a new
+// groupSchema is applied to them
+func (r *LdapGroupReconciler) groupsForServer(o handler.MapObject) []reconcile.Request {
+	var ldapGroups ldapv1.LdapGroupList
+	if err := r.List(context.Background(), &ldapGroups); err != nil {
+		r.Log.Error(err, "unable to list ldap groups for server", "ldapserver", o.Meta.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
 	for _, acc := range ldapGroups.Items {
-		msg := fmt.Sprintf("Checking group %s", acc.Spec.Name)
-		log.Info(msg)
-		acc.Status.CreatedOn = time.Now().Format("2006-01-02 15:04:05")
+		if ldapServerName(acc.Spec.Server, r.DefaultServer) == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: acc.Namespace, Name: acc.Name},
+			})
+		}
+	}
+	return requests
+}
+
+// groupsForUser maps an LdapUser to the groups listing it as a member, by
+// username or by uid number
+func (r *LdapGroupReconciler) groupsForUser(o handler.MapObject) []reconcile.Request {
+	ldapuser, ok := o.Object.(*ldapv1.LdapUser)
+	if !ok {
+		return nil
+	}
+	members := []string{ldapuser.Spec.Username}
+	if ldapuser.Spec.UID != "" {
+		members = append(members, ldapuser.Spec.UID)
 	}
 
-	return ctrl.Result{}, nil
+	var requests []reconcile.Request
+	seen := map[types.NamespacedName]bool{}
+	for _, member := range members {
+		var ldapGroups ldapv1.LdapGroupList
+		if err := r.List(context.Background(), &ldapGroups, client.MatchingFields{ldapGroupMemberKey: member}); err != nil {
+			r.Log.Error(err, "unable to list ldap groups for user", "ldapuser", o.Meta.GetName())
+			return nil
+		}
+		for _, acc := range ldapGroups.Items {
+			key := types.NamespacedName{Namespace: acc.Namespace, Name: acc.Name}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return requests
+}
+
+// userWritten tells whether the user reconciler updated the status after
+// writing or moving the entry, as it does after each attempt at a new
+// generation and each write to LDAP
+func userWritten(oldUser *ldapv1.LdapUser, newUser *ldapv1.LdapUser) bool {
+	return oldUser.Status.DN != newUser.Status.DN ||
+		oldUser.Status.ObservedGeneration != newUser.Status.ObservedGeneration ||
+		oldUser.Status.UpdatedOn != newUser.Status.UpdatedOn
 }
 
 func (r *LdapGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -121,12 +385,47 @@ func (r *LdapGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}); err != nil {
 		return err
 	}
+	if err := mgr.GetFieldIndexer().IndexField(&ldapv1.LdapGroup{}, ldapv1.GroupNameField, func(rawObj runtime.Object) []string {
+		acc := rawObj.(*ldapv1.LdapGroup)
+		return []string{acc.Spec.Name}
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(&ldapv1.LdapGroup{}, ldapv1.GIDField, func(rawObj runtime.Object) []string {
+		acc := rawObj.(*ldapv1.LdapGroup)
+		if acc.Spec.GID == "" {
+			return nil
+		}
+		return []string{acc.Spec.GID}
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(&ldapv1.LdapGroup{}, ldapGroupMemberKey, func(rawObj runtime.Object) []string {
+		acc := rawObj.(*ldapv1.LdapGroup)
+		return acc.Spec.Members
+	}); err != nil {
+		return err
+	}
 	//! [pred]
 	pred := predicate.Funcs{
-		CreateFunc:  func(event.CreateEvent) bool { return true },
-		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		CreateFunc: func(event.CreateEvent) bool { return true },
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			// a deleted member has to be removed from its groups
+			_, ok := e.Object.(*ldapv1.LdapUser)
+			return ok
+		},
 		GenericFunc: func(event.GenericEvent) bool { return true },
 		UpdateFunc: func(e event.UpdateEvent) bool {
+			// members are looked up in LDAP, so their groups are updated
+			// once the user's entry is written, not on the spec change
+			// before it
+			if oldUser, ok := e.ObjectOld.(*ldapv1.LdapUser); ok {
+				return userWritten(oldUser, e.ObjectNew.(*ldapv1.LdapUser))
+			}
+			// adding the adopt annotation retries a refused object
+			if e.MetaOld.GetAnnotations()[ldapv1.AdoptAnnotation] != e.MetaNew.GetAnnotations()[ldapv1.AdoptAnnotation] {
+				return true
+			}
 			oldGeneration := e.MetaOld.GetGeneration()
 			newGeneration := e.MetaNew.GetGeneration()
 			// Generation is only updated on spec changes (also on deletion),
@@ -139,6 +438,12 @@ func (r *LdapGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	//! [pred]
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ldapv1.LdapGroup{}).
+		Watches(&source.Kind{Type: &ldapv1.LdapUser{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.groupsForUser),
+		}).
+		Watches(&source.Kind{Type: &ldapv1.LdapServer{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.groupsForServer),
+		}).
 		WithEventFilter(pred).
 		Complete(r)
 }
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+)
+
+var _ = Describe("LdapGroup controller", func() {
+	const groupDN = "cn=admins,ou=Groups," + testBaseDN
+	ctx := context.Background()
+
+	It("creates and deletes the LDAP entry", func() {
+		group := &ldapv1.LdapGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "admins", Namespace: "default"},
+			Spec: ldapv1.LdapGroupSpec{
+				Name: "admins",
+				GID:  "2000",
+			},
+		}
+		Expect(k8sClient.Create(ctx, group)).To(Succeed())
+
+		Eventually(func() string {
+			entry := ldapServer.Dir.Entry(groupDN)
+			if entry == nil {
+				return ""
+			}
+			return entry.GetAttributeValue("gidNumber")
+		}, testTimeout).Should(Equal("2000"))
+
+		Expect(k8sClient.Delete(ctx, group)).To(Succeed())
+		Eventually(func() bool {
+			return ldapServer.Dir.Entry(groupDN) == nil
+		}, testTimeout).Should(BeTrue())
+	})
+
+	It("follows members created and deleted after the group", func() {
+		const staffDN = "cn=staff,ou=Groups," + testBaseDN
+		group := &ldapv1.LdapGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "staff", Namespace: "default"},
+			Spec: ldapv1.LdapGroupSpec{
+				Name:    "staff",
+				GID:     "2100",
+				Members: []string{"late"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, group)).To(Succeed())
+		Eventually(func() *ldap.Entry {
+			return ldapServer.Dir.Entry(staffDN)
+		}, testTimeout).ShouldNot(BeNil())
+		Expect(ldapServer.Dir.Entry(staffDN).GetAttributeValues("memberUid")).To(BeEmpty())
+
+		By("adding the member once the user exists")
+		user := &ldapv1.LdapUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "late", Namespace: "default"},
+			Spec:       ldapv1.LdapUserSpec{Username: "late", UID: "1200", GID: "2100"},
+		}
+		Expect(k8sClient.Create(ctx, user)).To(Succeed())
+		Eventually(func() []string {
+			return ldapServer.Dir.Entry(staffDN).GetAttributeValues("memberUid")
+		}, testTimeout).Should(Equal([]string{"late"}))
+
+		By("removing the member when the user is deleted")
+		Expect(k8sClient.Delete(ctx, user)).To(Succeed())
+		Eventually(func() []string {
+			return ldapServer.Dir.Entry(staffDN).GetAttributeValues("memberUid")
+		}, testTimeout).Should(BeEmpty())
+
+		Expect(k8sClient.Delete(ctx, group)).To(Succeed())
+	})
+})
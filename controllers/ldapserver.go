@@ -0,0 +1,159 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+	ld "ldap-accounts-controller/ldap"
+)
+
+// +kubebuilder:rbac:groups=ldap.digitalis.io,resources=ldapservers,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// ldapServerName returns the LdapServer an object refers to, falling back to
+// the manager wide default
+func ldapServerName(server string, def string) string {
+	if server != "" {
+		return server
+	}
+	return def
+}
+
+// ldapClient looks up the LdapServer and its secrets and returns the shared
+// LDAP client for it. It is resolved on every reconcile so changes to the
+// LdapServer are picked up without restarting the manager. When dir is set it
+// is used instead of connecting to the server.
+func ldapClient(ctx context.Context, c client.Client, clients *ld.ClientCache, dir ld.Directory, name string) (*ld.Client, error) {
+	var server ldapv1.LdapServer
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, &server); err != nil {
+		return nil, serverError(name, err)
+	}
+
+	config := ld.Config{
+		Hostname:       server.Spec.Host,
+		Port:           int(server.Spec.Port),
+		BaseDN:         server.Spec.BaseDN,
+		BindDN:         server.Spec.BindDN,
+		PasswordScheme: server.Spec.PasswordScheme,
+
+		UserDNTemplate:  server.Spec.UserDNTemplate,
+		GroupDNTemplate: server.Spec.GroupDNTemplate,
+		UserOU:          server.Spec.UserOU,
+		GroupOU:         server.Spec.GroupOU,
+
+		DeletionPolicy: server.Spec.DeletionPolicy,
+	}
+	if server.Spec.GroupSchema != nil {
+		config.GroupSchema = *server.Spec.GroupSchema
+	}
+	if dir != nil {
+		return ld.NewDirectoryClient(config, dir), nil
+	}
+
+	ref := server.Spec.BindPasswordSecretRef
+	password, err := secretValue(ctx, c, ref.Namespace, ref.Name, ref.Key)
+	if err != nil {
+		return nil, err
+	}
+	config.BindPassword = string(password)
+
+	if tls := server.Spec.TLS; tls != nil && (tls.Enabled || tls.StartTLS) {
+		config.TLS = true
+		config.StartTLS = tls.StartTLS
+		config.TLSInsecure = tls.InsecureSkipVerify
+		if tls.SecretRef != nil {
+			var secret corev1.Secret
+			if err := c.Get(ctx, types.NamespacedName{Namespace: tls.SecretRef.Namespace, Name: tls.SecretRef.Name}, &secret); err != nil {
+				return nil, fmt.Errorf("unable to fetch secret %s/%s: %w", tls.SecretRef.Namespace, tls.SecretRef.Name, err)
+			}
+			config.TLSCA = secret.Data["ca.crt"]
+			config.TLSCert = secret.Data[corev1.TLSCertKey]
+			config.TLSKey = secret.Data[corev1.TLSPrivateKeyKey]
+		}
+	}
+
+	return clients.Get(name, config), nil
+}
+
+// removalClient returns the deletion policy of an object's entry, its own or
+// the LdapServer's, and the client to apply it with. The client is nil when
+// the policy is Retain, as nothing is done in LDAP then. A
+// serverNotFoundError means the LdapServer is gone and the entry can only be
+// left in place.
+func removalClient(ctx context.Context, c client.Client, clients *ld.ClientCache, dir ld.Directory, policy ldapv1.DeletionPolicy, name string) (ldapv1.DeletionPolicy, *ld.Client, error) {
+	if policy == "" {
+		var server ldapv1.LdapServer
+		if err := c.Get(ctx, types.NamespacedName{Name: name}, &server); err != nil {
+			return "", nil, serverError(name, err)
+		}
+		policy = server.Spec.DeletionPolicy
+	}
+	if policy == "" {
+		policy = ldapv1.DeletionPolicyDelete
+	}
+	if policy == ldapv1.DeletionPolicyRetain {
+		return policy, nil, nil
+	}
+	ldc, err := ldapClient(ctx, c, clients, dir, name)
+	return policy, ldc, err
+}
+
+// serverNotFoundError is returned when the LdapServer itself doesn't exist,
+// as opposed to its Secrets
+type serverNotFoundError struct {
+	name string
+}
+
+func (e *serverNotFoundError) Error() string {
+	return fmt.Sprintf("ldap server %s not found", e.name)
+}
+
+// serverError wraps the error of fetching the LdapServer
+func serverError(name string, err error) error {
+	if apierrors.IsNotFound(err) {
+		return &serverNotFoundError{name}
+	}
+	return fmt.Errorf("unable to fetch ldap server %s: %w", name, err)
+}
+
+// isServerNotFound tells whether err is, or wraps, a serverNotFoundError
+func isServerNotFound(err error) bool {
+	var notFound *serverNotFoundError
+	return errors.As(err, &notFound)
+}
+
+// secretValue returns a single key of a Secret
+func secretValue(ctx context.Context, c client.Client, namespace string, name string, key string) ([]byte, error) {
+	var secret corev1.Secret
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &secret); err != nil {
+		return nil, fmt.Errorf("unable to fetch secret %s/%s: %w", namespace, name, err)
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no key %s", namespace, name, key)
+	}
+	return value, nil
+}
@@ -18,22 +18,37 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	ldapv1 "ldap-accounts-controller/api/v1"
 	ld "ldap-accounts-controller/ldap"
 )
 
 var (
-	ldapUserOwnerKey = ".metadata.controller"
+	ldapUserOwnerKey          = ".metadata.controller"
+	ldapUserPasswordSecretKey = ".spec.passwordSecretRef.name"
+	ldapUserKeySecretKey      = ".spec.sshPublicKeysFrom.secretKeyRef.name"
+	ldapUserKeyConfigMapKey   = ".spec.sshPublicKeysFrom.configMapKeyRef.name"
 )
 
 // LdapUserReconciler reconciles a LdapUser object
@@ -41,10 +56,28 @@ type LdapUserReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// DefaultServer is the LdapServer used by objects that don't name one
+	DefaultServer string
+	// DefaultIDPool is the LdapIDPool used by objects that don't name one
+	DefaultIDPool string
+	// LdapClients is shared by the reconcilers so they reuse connections
+	LdapClients *ld.ClientCache
+	// Recorder records events on the objects
+	Recorder record.EventRecorder
+	// Directory, when set, is used instead of connecting to the LdapServer,
+	// for example a MemoryDirectory in tests
+	Directory ld.Directory
+	// MigratePasswords moves inline spec.password values into Secrets
+	MigratePasswords bool
+	// ResyncInterval is how often the LDAP entry is checked for drift, zero
+	// disables it
+	ResyncInterval time.Duration
 }
 
 // +kubebuilder:rbac:groups=ldap.digitalis.io,resources=ldapusers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=ldap.digitalis.io,resources=ldapusers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 
 func (r *LdapUserReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -68,10 +101,29 @@ func (r *LdapUserReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	} else {
 		// The object is being deleted
 		if containsString(ldapuser.GetFinalizers(), ldapuserFinalizerName) {
-			// our finalizer is present, so lets handle any external dependency
-			if err := ld.DeleteUser(ldapuser.Spec); err != nil {
-				log.Error(err, "Error deleting from LDAP")
-				return ctrl.Result{}, err
+			// our finalizer is present, so lets handle any external dependency,
+			// unless the entry belongs to someone else
+			if !isConflicted(ldapuser.Status.Conditions) {
+				policy, ldc, err := removalClient(ctx, r, r.LdapClients, r.Directory, ldapuser.Spec.DeletionPolicy, ldapServerName(ldapuser.Spec.Server, r.DefaultServer))
+				switch {
+				case isServerNotFound(err):
+					// nothing can be done in LDAP anymore, don't keep the
+					// object around for it
+					log.Info("Leaving LDAP entry in place", "reason", err.Error())
+					r.Recorder.Eventf(&ldapuser, corev1.EventTypeWarning, reasonServerUnavailable, "Left LDAP entry %s in place: %s", ldapuser.Status.DN, err)
+				case err != nil:
+					log.Error(err, "unable to resolve ldap server")
+					return r.failed(ctx, &ldapuser, metav1.ConditionUnknown, reasonServerUnavailable, err)
+				default:
+					if ldc != nil {
+						if _, err := ldc.RemoveUser(ldapuser.Spec); err != nil {
+							log.Error(err, "Error deleting from LDAP")
+							return r.failed(ctx, &ldapuser, metav1.ConditionUnknown, reasonLdapError, err)
+						}
+					}
+					log.Info("Applied deletion policy", "policy", policy)
+					r.Recorder.Eventf(&ldapuser, corev1.EventTypeNormal, deletionEvent[policy], "%s LDAP entry %s", deletionEvent[policy], ldapuser.Status.DN)
+				}
 			}
 
 			// remove our finalizer from the list and update it.
@@ -86,26 +138,373 @@ func (r *LdapUserReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 	//! [finalizer]
 
+	ldc, err := ldapClient(ctx, r, r.LdapClients, r.Directory, ldapServerName(ldapuser.Spec.Server, r.DefaultServer))
+	if err != nil {
+		log.Error(err, "unable to resolve ldap server")
+		return r.failed(ctx, &ldapuser, metav1.ConditionUnknown, reasonServerUnavailable, err)
+	}
+
+	if !ownsEntry(ldapuser.Status.Managed, ldapuser.Status.DN, ldapuser.Status.CreatedOn) {
+		adopted, exists, err := ldc.AdoptUser(ldapuser.SpecWithoutDefaults())
+		if err != nil {
+			log.Error(err, "unable to look up existing ldap user")
+			return r.failed(ctx, &ldapuser, metav1.ConditionUnknown, reasonLdapError, err)
+		}
+		if exists {
+			if ldapuser.Annotations[ldapv1.AdoptAnnotation] != "true" {
+				err := &conflictError{fmt.Sprintf("LDAP user %s already exists, set the %s annotation to adopt it", ldapuser.Spec.Username, ldapv1.AdoptAnnotation)}
+				log.Info("Refusing to write LDAP user", "reason", err.Error())
+				return r.conflicted(ctx, &ldapuser, err)
+			}
+			_, defaulted := ldapuser.Annotations[ldapv1.DefaultedAnnotation]
+			if defaulted || !reflect.DeepEqual(adopted, ldapuser.Spec) {
+				// the entry's values replace the webhook's defaults
+				ldapuser.Spec = adopted
+				delete(ldapuser.Annotations, ldapv1.DefaultedAnnotation)
+				if err := r.Update(ctx, &ldapuser); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			log.Info("Adopted existing LDAP user")
+			r.Recorder.Eventf(&ldapuser, corev1.EventTypeNormal, eventAdopted, "Adopted existing LDAP user %s", ldapuser.Spec.Username)
+		}
+
+		// recorded before writing, so that the entry isn't taken for someone
+		// else's when the status can't be updated afterwards
+		ldapuser.Status.Managed = true
+		if err := r.Status().Update(ctx, &ldapuser); err != nil {
+			log.Error(err, "unable to update ldap user status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if ldapuser.Spec.UID == "" || ldapuser.Spec.GID == "" {
+		if err := r.allocateIDs(ctx, ldc, &ldapuser); err != nil {
+			log.Error(err, "unable to allocate uid or gid")
+			return r.failed(ctx, &ldapuser, metav1.ConditionUnknown, reasonIDAllocation, err)
+		}
+		log.Info("Allocated ids", "uid", ldapuser.Spec.UID, "gid", ldapuser.Spec.GID)
+	}
+
+	if err := userConflict(ctx, r, ldc, &ldapuser, r.DefaultServer); err != nil {
+		if _, ok := err.(*conflictError); ok {
+			log.Info("Refusing to write LDAP user", "reason", err.Error())
+			return r.conflicted(ctx, &ldapuser, err)
+		}
+		log.Error(err, "unable to check ldap user for conflicts")
+		return r.failed(ctx, &ldapuser, metav1.ConditionUnknown, reasonLdapError, err)
+	}
+	setUnique(&ldapuser.Status.Conditions, ldapuser.Generation)
+
+	if r.MigratePasswords && ldapuser.Spec.Password != "" && ldapuser.Spec.PasswordSecretRef == nil {
+		log.Info("Moving inline password to a secret")
+		if err := r.migratePassword(ctx, &ldapuser); err != nil {
+			log.Error(err, "unable to move password to a secret")
+			return r.failed(ctx, &ldapuser, metav1.ConditionUnknown, reasonPasswordError, err)
+		}
+	}
+
+	user := ldapuser.Spec
+	var secretVersion string
+	if user.Password, secretVersion, err = r.userPassword(ctx, &ldapuser); err != nil {
+		log.Error(err, "unable to read user password")
+		return r.failed(ctx, &ldapuser, metav1.ConditionUnknown, reasonPasswordError, err)
+	}
+	var fingerprints []string
+	if user.SSHPublicKeys, fingerprints, err = r.sshPublicKeys(ctx, &ldapuser); err != nil {
+		log.Error(err, "unable to read user ssh keys")
+		return r.failed(ctx, &ldapuser, metav1.ConditionUnknown, reasonSSHKeyError, err)
+	}
+
+	var drift []string
+	// a new password or key in a Secret or ConfigMap is a change to apply,
+	// not drift
+	if isResync(ldapuser.Status.Conditions, ldapuser.Generation) && ldapuser.Status.PasswordSecretVersion == secretVersion &&
+		sameMembers(ldapuser.Status.SSHKeyFingerprints, fingerprints) {
+		var exists bool
+		if drift, exists, err = ldc.UserDrift(user); err != nil {
+			log.Error(err, "unable to check ldap user for drift")
+			return r.failed(ctx, &ldapuser, metav1.ConditionUnknown, reasonLdapError, err)
+		}
+		if !exists {
+			drift = []string{driftEntry}
+		}
+		ldapuser.Status.Drift = drift
+		if len(drift) == 0 {
+			setSynced(&ldapuser.Status.Conditions, ldapuser.Generation, nil)
+			return r.resynced(ctx, &ldapuser)
+		}
+
+		log.Info("LDAP user was changed outside of the controller", "drift", drift)
+		if ldapuser.Spec.DriftPolicy == ldapv1.DriftPolicyReport {
+			setDrifted(&ldapuser.Status.Conditions, ldapuser.Generation, drift)
+			return r.resynced(ctx, &ldapuser)
+		}
+	} else {
+		ldapuser.Status.Drift = nil
+	}
+
 	log.Info("Adding or updating LDAP user")
-	err := ld.AddUser(ldapuser.Spec)
+	dn, changes, err := ldc.AddUser(user)
 	if err != nil {
 		log.Error(err, "cannot add user to ldap")
+		existing, lookupErr := ldc.GetUser(user.Username)
+		return r.failed(ctx, &ldapuser, entryExists(existing.Username != "", lookupErr), reasonLdapError, err)
 	}
-	ldapuser.Status.CreatedOn = time.Now().Format("2006-01-02 15:04:05")
+	switch {
+	case containsString(changes, ld.EntryChange):
+		r.Recorder.Eventf(&ldapuser, corev1.EventTypeNormal, eventCreated, "Created LDAP entry %s", dn)
+	case len(changes) != 0:
+		r.Recorder.Eventf(&ldapuser, corev1.EventTypeNormal, eventUpdated, "Updated %s of LDAP entry %s", strings.Join(changes, ", "), dn)
+	}
+
+	now := time.Now().Format(timeFormat)
+	if ldapuser.Status.CreatedOn == "" {
+		ldapuser.Status.CreatedOn = now
+	}
+	ldapuser.Status.UpdatedOn = now
+	ldapuser.Status.DN = dn
+	ldapuser.Status.Managed = true
+	ldapuser.Status.PasswordSecretVersion = secretVersion
+	ldapuser.Status.SSHKeyFingerprints = fingerprints
+	setSynced(&ldapuser.Status.Conditions, ldapuser.Generation, drift)
+	return r.resynced(ctx, &ldapuser)
+}
+
+// resynced writes the status and schedules the next drift check
+func (r *LdapUserReconciler) resynced(ctx context.Context, ldapuser *ldapv1.LdapUser) (ctrl.Result, error) {
+	setExpiry(&ldapuser.Status, ldapuser.Spec.ExpiresOn, time.Now().UTC())
+	ldapuser.Status.ObservedGeneration = ldapuser.Generation
+	if err := r.Status().Update(ctx, ldapuser); err != nil {
+		r.Log.Error(err, "unable to update ldap user status", "ldapuser", ldapuser.Name)
+		reconcileTotal.WithLabelValues("LdapUser", resultFailure).Inc()
+		return ctrl.Result{}, err
+	}
+	reconcileTotal.WithLabelValues("LdapUser", resultSuccess).Inc()
+	return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+}
 
-	var ldapUsers ldapv1.LdapUserList
-	if err := r.List(ctx, &ldapUsers, client.InNamespace(req.Namespace), client.MatchingFields{ldapUserOwnerKey: req.Name}); err != nil {
-		log.Error(err, "unable to list ldap accounts")
+// failed records err in the status and returns it so the request is retried
+func (r *LdapUserReconciler) failed(ctx context.Context, ldapuser *ldapv1.LdapUser, ready metav1.ConditionStatus, reason string, err error) (ctrl.Result, error) {
+	if isNewFailure(ldapuser.Status.Conditions, reason, err) {
+		r.Recorder.Event(ldapuser, corev1.EventTypeWarning, warningReason(reason, err), err.Error())
+	}
+	setFailed(&ldapuser.Status.Conditions, ldapuser.Generation, ready, reason, err)
+	ldapuser.Status.ObservedGeneration = ldapuser.Generation
+	if err := r.Status().Update(ctx, ldapuser); err != nil {
+		r.Log.Error(err, "unable to update ldap user status", "ldapuser", ldapuser.Name)
+	}
+	reconcileTotal.WithLabelValues("LdapUser", resultFailure).Inc()
+	return ctrl.Result{}, err
+}
+
+// conflicted records that the user clashes with another one and checks again
+// later, as the other one may go away
+func (r *LdapUserReconciler) conflicted(ctx context.Context, ldapuser *ldapv1.LdapUser, err error) (ctrl.Result, error) {
+	setConflict(&ldapuser.Status.Conditions, ldapuser.Generation, err)
+	ldapuser.Status.ObservedGeneration = ldapuser.Generation
+	if err := r.Status().Update(ctx, ldapuser); err != nil {
+		r.Log.Error(err, "unable to update ldap user status", "ldapuser", ldapuser.Name)
+		reconcileTotal.WithLabelValues("LdapUser", resultFailure).Inc()
 		return ctrl.Result{}, err
 	}
+	reconcileTotal.WithLabelValues("LdapUser", resultConflict).Inc()
+	return ctrl.Result{RequeueAfter: conflictRequeue(r.ResyncInterval)}, nil
+}
 
-	for _, acc := range ldapUsers.Items {
-		msg := fmt.Sprintf("Checking user %s", acc.Spec.Username)
-		log.Info(msg)
-		acc.Status.CreatedOn = time.Now().Format("2006-01-02 15:04:05")
+// allocateIDs fills in the empty uid and gid from the user's LdapIDPool and
+// stores them in the spec so they don't change again
+func (r *LdapUserReconciler) allocateIDs(ctx context.Context, ldc *ld.Client, ldapuser *ldapv1.LdapUser) error {
+	pool := ldapuser.Spec.IDPool
+	if pool == "" {
+		pool = r.DefaultIDPool
+	}
+	owner := fmt.Sprintf("LdapUser/%s/%s", ldapuser.Namespace, ldapuser.Name)
+	var err error
+	if ldapuser.Spec.UID == "" {
+		if ldapuser.Spec.UID, err = allocateID(ctx, r, ldc, pool, false, owner); err != nil {
+			return err
+		}
+	}
+	if ldapuser.Spec.GID == "" {
+		if ldapuser.Spec.GID, err = allocateID(ctx, r, ldc, pool, true, owner); err != nil {
+			return err
+		}
 	}
+	return r.Update(ctx, ldapuser)
+}
 
-	return ctrl.Result{}, nil
+// userPassword returns the password from the referenced Secret along with the
+// Secret's resourceVersion, or the deprecated inline one
+func (r *LdapUserReconciler) userPassword(ctx context.Context, ldapuser *ldapv1.LdapUser) (string, string, error) {
+	ref := ldapuser.Spec.PasswordSecretRef
+	if ref == nil {
+		return ldapuser.Spec.Password, "", nil
+	}
+	var secret corev1.Secret
+	if err := r.Get(ctx, types.NamespacedName{Namespace: ldapuser.Namespace, Name: ref.Name}, &secret); err != nil {
+		return "", "", fmt.Errorf("unable to fetch secret %s/%s: %s", ldapuser.Namespace, ref.Name, err)
+	}
+	password, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", "", fmt.Errorf("secret %s/%s has no key %s", ldapuser.Namespace, ref.Name, ref.Key)
+	}
+	return string(password), secret.ResourceVersion, nil
+}
+
+// sshPublicKeys returns the user's keys, the inline ones followed by those
+// read from Secrets and ConfigMaps, along with their fingerprints
+func (r *LdapUserReconciler) sshPublicKeys(ctx context.Context, ldapuser *ldapv1.LdapUser) ([]string, []string, error) {
+	keys := append([]string{}, ldapuser.Spec.SSHPublicKeys...)
+	for _, source := range ldapuser.Spec.SSHPublicKeysFrom {
+		var data string
+		switch {
+		case source.SecretKeyRef != nil:
+			ref := source.SecretKeyRef
+			var secret corev1.Secret
+			if err := r.Get(ctx, types.NamespacedName{Namespace: ldapuser.Namespace, Name: ref.Name}, &secret); err != nil {
+				return nil, nil, fmt.Errorf("unable to fetch secret %s/%s: %s", ldapuser.Namespace, ref.Name, err)
+			}
+			value, ok := secret.Data[ref.Key]
+			if !ok {
+				return nil, nil, fmt.Errorf("secret %s/%s has no key %s", ldapuser.Namespace, ref.Name, ref.Key)
+			}
+			data = string(value)
+		case source.ConfigMapKeyRef != nil:
+			ref := source.ConfigMapKeyRef
+			var configMap corev1.ConfigMap
+			if err := r.Get(ctx, types.NamespacedName{Namespace: ldapuser.Namespace, Name: ref.Name}, &configMap); err != nil {
+				return nil, nil, fmt.Errorf("unable to fetch configmap %s/%s: %s", ldapuser.Namespace, ref.Name, err)
+			}
+			value, ok := configMap.Data[ref.Key]
+			if !ok {
+				return nil, nil, fmt.Errorf("configmap %s/%s has no key %s", ldapuser.Namespace, ref.Name, ref.Key)
+			}
+			data = value
+		}
+		keys = append(keys, authorizedKeys(data)...)
+	}
+
+	var unique, fingerprints []string
+	seen := map[string]bool{}
+	for _, key := range keys {
+		fingerprint, err := ldapv1.SSHKeyFingerprint(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid ssh key %q: %s", key, err)
+		}
+		// the same key may be listed inline and in a Secret
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+		unique = append(unique, key)
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	return unique, fingerprints, nil
+}
+
+// authorizedKeys splits an authorized_keys file into its keys, skipping
+// blank lines and comments
+func authorizedKeys(data string) []string {
+	var keys []string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys
+}
+
+// migratePassword stores the inline password in a Secret owned by the user
+// and points the spec at it. A Secret of the same name that the user doesn't
+// own is left alone.
+func (r *LdapUserReconciler) migratePassword(ctx context.Context, ldapuser *ldapv1.LdapUser) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ldapuser.Name + "-password",
+			Namespace: ldapuser.Namespace,
+		},
+	}
+	var existing corev1.Secret
+	err := r.Get(ctx, types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}, &existing)
+	if err == nil && !metav1.IsControlledBy(&existing, ldapuser) {
+		return fmt.Errorf("secret %s/%s already exists and is not owned by the user, set spec.passwordSecretRef instead", secret.Namespace, secret.Name)
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to fetch secret %s/%s: %s", secret.Namespace, secret.Name, err)
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r, secret, func() error {
+		secret.Data = map[string][]byte{"password": []byte(ldapuser.Spec.Password)}
+		return controllerutil.SetControllerReference(ldapuser, secret, r.Scheme)
+	}); err != nil {
+		return err
+	}
+
+	ldapuser.Spec.Password = ""
+	ldapuser.Spec.PasswordSecretRef = &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name},
+		Key:                  "password",
+	}
+	scrubLastApplied(ldapuser)
+	return r.Update(ctx, ldapuser)
+}
+
+// scrubLastApplied removes the inline password from the configuration kubectl
+// apply keeps in an annotation, so it isn't left in plain text on the object
+func scrubLastApplied(ldapuser *ldapv1.LdapUser) {
+	applied, ok := ldapuser.Annotations[corev1.LastAppliedConfigAnnotation]
+	if !ok {
+		return
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(applied), &config); err == nil {
+		if spec, ok := config["spec"].(map[string]interface{}); ok {
+			delete(spec, "password")
+		}
+		if scrubbed, err := json.Marshal(config); err == nil {
+			ldapuser.Annotations[corev1.LastAppliedConfigAnnotation] = string(scrubbed)
+			return
+		}
+	}
+	// drop what can't be scrubbed rather than keep the password
+	delete(ldapuser.Annotations, corev1.LastAppliedConfigAnnotation)
+}
+
+// usersForSecret maps a Secret to the users taking their password or SSH
+// keys from it
+func (r *LdapUserReconciler) usersForSecret(o handler.MapObject) []reconcile.Request {
+	return r.usersReferencing(o, ldapUserPasswordSecretKey, ldapUserKeySecretKey)
+}
+
+// usersForConfigMap maps a ConfigMap to the users taking SSH keys from it
+func (r *LdapUserReconciler) usersForConfigMap(o handler.MapObject) []reconcile.Request {
+	return r.usersReferencing(o, ldapUserKeyConfigMapKey)
+}
+
+// usersReferencing returns the users in the object's namespace naming it in
+// any of the given indexes
+func (r *LdapUserReconciler) usersReferencing(o handler.MapObject, indexes ...string) []reconcile.Request {
+	var requests []reconcile.Request
+	seen := map[string]bool{}
+	for _, index := range indexes {
+		var ldapUsers ldapv1.LdapUserList
+		if err := r.List(context.Background(), &ldapUsers, client.InNamespace(o.Meta.GetNamespace()), client.MatchingFields{index: o.Meta.GetName()}); err != nil {
+			r.Log.Error(err, "unable to list ldap users referencing object", "name", o.Meta.GetName(), "index", index)
+			return nil
+		}
+		for _, acc := range ldapUsers.Items {
+			if seen[acc.Name] {
+				continue
+			}
+			seen[acc.Name] = true
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: acc.Namespace, Name: acc.Name},
+			})
+		}
+	}
+	return requests
 }
 
 // Helper functions to check and remove string from a slice of strings.
@@ -135,12 +534,71 @@ func (r *LdapUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}); err != nil {
 		return err
 	}
+	if err := mgr.GetFieldIndexer().IndexField(&ldapv1.LdapUser{}, ldapUserPasswordSecretKey, func(rawObj runtime.Object) []string {
+		acc := rawObj.(*ldapv1.LdapUser)
+		if acc.Spec.PasswordSecretRef == nil {
+			return nil
+		}
+		return []string{acc.Spec.PasswordSecretRef.Name}
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(&ldapv1.LdapUser{}, ldapUserKeySecretKey, func(rawObj runtime.Object) []string {
+		acc := rawObj.(*ldapv1.LdapUser)
+		var names []string
+		for _, source := range acc.Spec.SSHPublicKeysFrom {
+			if source.SecretKeyRef != nil {
+				names = append(names, source.SecretKeyRef.Name)
+			}
+		}
+		return names
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(&ldapv1.LdapUser{}, ldapUserKeyConfigMapKey, func(rawObj runtime.Object) []string {
+		acc := rawObj.(*ldapv1.LdapUser)
+		var names []string
+		for _, source := range acc.Spec.SSHPublicKeysFrom {
+			if source.ConfigMapKeyRef != nil {
+				names = append(names, source.ConfigMapKeyRef.Name)
+			}
+		}
+		return names
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(&ldapv1.LdapUser{}, ldapv1.UsernameField, func(rawObj runtime.Object) []string {
+		acc := rawObj.(*ldapv1.LdapUser)
+		return []string{acc.Spec.Username}
+	}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(&ldapv1.LdapUser{}, ldapv1.UIDField, func(rawObj runtime.Object) []string {
+		acc := rawObj.(*ldapv1.LdapUser)
+		if acc.Spec.UID == "" {
+			return nil
+		}
+		return []string{acc.Spec.UID}
+	}); err != nil {
+		return err
+	}
 	//! [pred]
 	pred := predicate.Funcs{
 		CreateFunc:  func(event.CreateEvent) bool { return true },
 		DeleteFunc:  func(event.DeleteEvent) bool { return false },
 		GenericFunc: func(event.GenericEvent) bool { return true },
 		UpdateFunc: func(e event.UpdateEvent) bool {
+			// Secrets have no generation, only their data matters
+			if oldSecret, ok := e.ObjectOld.(*corev1.Secret); ok {
+				return !reflect.DeepEqual(oldSecret.Data, e.ObjectNew.(*corev1.Secret).Data)
+			}
+			if oldConfigMap, ok := e.ObjectOld.(*corev1.ConfigMap); ok {
+				return !reflect.DeepEqual(oldConfigMap.Data, e.ObjectNew.(*corev1.ConfigMap).Data)
+			}
+			// adding the adopt annotation retries a refused object
+			if e.MetaOld.GetAnnotations()[ldapv1.AdoptAnnotation] != e.MetaNew.GetAnnotations()[ldapv1.AdoptAnnotation] {
+				return true
+			}
 			oldGeneration := e.MetaOld.GetGeneration()
 			newGeneration := e.MetaNew.GetGeneration()
 			// Generation is only updated on spec changes (also on deletion),
@@ -153,6 +611,12 @@ func (r *LdapUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	//! [pred]
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ldapv1.LdapUser{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.usersForSecret),
+		}).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.usersForConfigMap),
+		}).
 		WithEventFilter(pred).
 		Complete(r)
 }
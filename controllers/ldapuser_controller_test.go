@@ -0,0 +1,215 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+)
+
+var _ = Describe("LdapUser controller", func() {
+	const userDN = "uid=user01,ou=People," + testBaseDN
+	ctx := context.Background()
+
+	It("creates, updates and deletes the LDAP entry", func() {
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "user01-password", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("letmein")},
+		})).To(Succeed())
+		user := &ldapv1.LdapUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "user01", Namespace: "default"},
+			Spec: ldapv1.LdapUserSpec{
+				Username: "user01",
+				UID:      "1000",
+				GID:      "1000",
+				PasswordSecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "user01-password"},
+					Key:                  "password",
+				},
+				Shell: "/bin/sh",
+			},
+		}
+		Expect(k8sClient.Create(ctx, user)).To(Succeed())
+
+		By("adding the entry")
+		Eventually(func() string {
+			entry := ldapServer.Dir.Entry(userDN)
+			if entry == nil {
+				return ""
+			}
+			return entry.GetAttributeValue("loginShell")
+		}, testTimeout).Should(Equal("/bin/sh"))
+		Eventually(func() string {
+			var got ldapv1.LdapUser
+			if err := k8sClient.Get(ctx, types.NamespacedName{Name: "user01", Namespace: "default"}, &got); err != nil {
+				return ""
+			}
+			return got.Status.DN
+		}, testTimeout).Should(Equal(userDN))
+
+		By("updating the entry in place")
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "user01", Namespace: "default"}, user)).To(Succeed())
+		user.Spec.Shell = "/bin/bash"
+		Expect(k8sClient.Update(ctx, user)).To(Succeed())
+		Eventually(func() string {
+			return ldapServer.Dir.Entry(userDN).GetAttributeValue("loginShell")
+		}, testTimeout).Should(Equal("/bin/bash"))
+
+		By("removing the entry")
+		Expect(k8sClient.Delete(ctx, user)).To(Succeed())
+		Eventually(func() bool {
+			return ldapServer.Dir.Entry(userDN) == nil
+		}, testTimeout).Should(BeTrue())
+	})
+
+	It("refuses a username already used in another namespace", func() {
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}})).To(Succeed())
+		first := &ldapv1.LdapUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"},
+			Spec:       ldapv1.LdapUserSpec{Username: "shared", UID: "1100", GID: "1100"},
+		}
+		Expect(k8sClient.Create(ctx, first)).To(Succeed())
+		Eventually(func() *ldap.Entry {
+			return ldapServer.Dir.Entry("uid=shared,ou=People," + testBaseDN)
+		}, testTimeout).ShouldNot(BeNil())
+
+		second := &ldapv1.LdapUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "other"},
+			Spec:       ldapv1.LdapUserSpec{Username: "shared", UID: "1101", GID: "1100", Shell: "/bin/sh"},
+		}
+		Expect(k8sClient.Create(ctx, second)).To(Succeed())
+		Eventually(func() string {
+			var got ldapv1.LdapUser
+			if err := k8sClient.Get(ctx, types.NamespacedName{Name: "shared", Namespace: "other"}, &got); err != nil {
+				return ""
+			}
+			if c := ldapv1.FindCondition(got.Status.Conditions, ldapv1.ConditionConflict); c != nil {
+				return string(c.Status)
+			}
+			return ""
+		}, testTimeout).Should(Equal(string(metav1.ConditionTrue)))
+		Expect(ldapServer.Dir.Entry("uid=shared,ou=People," + testBaseDN).GetAttributeValue("uidNumber")).To(Equal("1100"))
+
+		By("leaving the entry alone when the refused user is deleted")
+		Expect(k8sClient.Delete(ctx, second)).To(Succeed())
+		Eventually(func() bool {
+			var got ldapv1.LdapUser
+			return apierrors.IsNotFound(k8sClient.Get(ctx, types.NamespacedName{Name: "shared", Namespace: "other"}, &got))
+		}, testTimeout).Should(BeTrue())
+		Expect(ldapServer.Dir.Entry("uid=shared,ou=People," + testBaseDN)).NotTo(BeNil())
+		Expect(k8sClient.Delete(ctx, first)).To(Succeed())
+	})
+
+	It("adopts an existing entry only when asked to", func() {
+		const legacyDN = "uid=olduser,ou=Legacy," + testBaseDN
+		add := ldap.NewAddRequest(legacyDN, nil)
+		add.Attribute("objectClass", []string{"posixAccount"})
+		add.Attribute("uid", []string{"olduser"})
+		add.Attribute("cn", []string{"Old User"})
+		add.Attribute("uidNumber", []string{"1300"})
+		add.Attribute("gidNumber", []string{"1300"})
+		add.Attribute("homeDirectory", []string{"/export/olduser"})
+		Expect(ldapServer.Dir.Add(add)).To(Succeed())
+
+		user := &ldapv1.LdapUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "olduser", Namespace: "default"},
+			Spec:       ldapv1.LdapUserSpec{Username: "olduser", Shell: "/bin/bash"},
+		}
+		Expect(k8sClient.Create(ctx, user)).To(Succeed())
+		key := types.NamespacedName{Name: "olduser", Namespace: "default"}
+		conflict := func() string {
+			var got ldapv1.LdapUser
+			if err := k8sClient.Get(ctx, key, &got); err != nil {
+				return ""
+			}
+			if c := ldapv1.FindCondition(got.Status.Conditions, ldapv1.ConditionConflict); c != nil {
+				return string(c.Status)
+			}
+			return ""
+		}
+		Eventually(conflict, testTimeout).Should(Equal(string(metav1.ConditionTrue)))
+		Expect(ldapServer.Dir.Entry(legacyDN).GetAttributeValue("loginShell")).To(BeEmpty())
+
+		By("taking the entry over with the annotation")
+		Expect(k8sClient.Get(ctx, key, user)).To(Succeed())
+		user.Annotations = map[string]string{ldapv1.AdoptAnnotation: "true"}
+		Expect(k8sClient.Update(ctx, user)).To(Succeed())
+		Eventually(conflict, testTimeout).Should(Equal(string(metav1.ConditionFalse)))
+		Eventually(func() string {
+			return ldapServer.Dir.Entry(legacyDN).GetAttributeValue("loginShell")
+		}, testTimeout).Should(Equal("/bin/bash"))
+		Expect(k8sClient.Get(ctx, key, user)).To(Succeed())
+		Expect(user.Spec.UID).To(Equal("1300"))
+		Expect(user.Spec.Homedir).To(Equal("/export/olduser"))
+		Expect(user.Status.Managed).To(BeTrue())
+	})
+
+	It("keeps the entry's values over the webhook defaults when adopting", func() {
+		const legacyDN = "uid=olduser2,ou=Legacy," + testBaseDN
+		add := ldap.NewAddRequest(legacyDN, nil)
+		add.Attribute("objectClass", []string{"posixAccount"})
+		add.Attribute("uid", []string{"olduser2"})
+		add.Attribute("cn", []string{"olduser2"})
+		add.Attribute("uidNumber", []string{"1301"})
+		add.Attribute("gidNumber", []string{"1301"})
+		add.Attribute("homeDirectory", []string{"/export/olduser2"})
+		add.Attribute("loginShell", []string{"/bin/ksh"})
+		add.Attribute("gecos", []string{"Old User"})
+		Expect(ldapServer.Dir.Add(add)).To(Succeed())
+
+		user := &ldapv1.LdapUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "olduser2", Namespace: "default"},
+			Spec:       ldapv1.LdapUserSpec{Username: "olduser2"},
+		}
+		// the test environment doesn't serve the webhooks, default the
+		// object as the mutating webhook does
+		user.Default()
+		Expect(user.Annotations).To(HaveKey(ldapv1.DefaultedAnnotation))
+		Expect(k8sClient.Create(ctx, user)).To(Succeed())
+		key := types.NamespacedName{Name: "olduser2", Namespace: "default"}
+		Eventually(func() bool {
+			var got ldapv1.LdapUser
+			return k8sClient.Get(ctx, key, &got) == nil && isConflicted(got.Status.Conditions)
+		}, testTimeout).Should(BeTrue())
+
+		By("adopting the entry")
+		Expect(k8sClient.Get(ctx, key, user)).To(Succeed())
+		user.Annotations[ldapv1.AdoptAnnotation] = "true"
+		Expect(k8sClient.Update(ctx, user)).To(Succeed())
+		Eventually(func() bool {
+			var got ldapv1.LdapUser
+			return k8sClient.Get(ctx, key, &got) == nil && got.Status.Managed && !isConflicted(got.Status.Conditions)
+		}, testTimeout).Should(BeTrue())
+		Expect(k8sClient.Get(ctx, key, user)).To(Succeed())
+		Expect(user.Spec.Homedir).To(Equal("/export/olduser2"))
+		Expect(user.Spec.Shell).To(Equal("/bin/ksh"))
+		Expect(user.Spec.Gecos).To(Equal("Old User"))
+		Expect(user.Annotations).NotTo(HaveKey(ldapv1.DefaultedAnnotation))
+		Consistently(func() string {
+			return ldapServer.Dir.Entry(legacyDN).GetAttributeValue("loginShell")
+		}, "2s").Should(Equal("/bin/ksh"))
+	})
+})
@@ -0,0 +1,41 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Reconcile outcomes recorded in the metrics
+const (
+	resultSuccess  = "success"
+	resultFailure  = "failure"
+	resultConflict = "conflict"
+)
+
+var reconcileTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ldap_reconcile_total",
+		Help: "Number of reconciles by kind and outcome",
+	},
+	[]string{"kind", "result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(reconcileTotal)
+}
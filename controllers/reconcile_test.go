@@ -0,0 +1,591 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+	ld "ldap-accounts-controller/ldap"
+)
+
+// testServer is the LdapServer the reconcilers under test write to
+var testServer = &ldapv1.LdapServer{
+	ObjectMeta: metav1.ObjectMeta{Name: "default"},
+	Spec: ldapv1.LdapServerSpec{
+		Host:   "ldap.example.com",
+		Port:   389,
+		BaseDN: "dc=example,dc=com",
+	},
+}
+
+// newTestClient returns a fake client holding objs
+func newTestClient(t *testing.T, objs ...runtime.Object) client.Client {
+	if err := ldapv1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewFakeClientWithScheme(scheme.Scheme, objs...)
+}
+
+// newTestUserReconciler returns a LdapUserReconciler using a fake client
+// holding objs and writing to dir
+func newTestUserReconciler(t *testing.T, dir ld.Directory, objs ...runtime.Object) *LdapUserReconciler {
+	return &LdapUserReconciler{
+		Client:        newTestClient(t, objs...),
+		Log:           ctrl.Log.WithName("controllers").WithName("LdapUser"),
+		Scheme:        scheme.Scheme,
+		DefaultServer: "default",
+		Recorder:      record.NewFakeRecorder(100),
+		Directory:     dir,
+	}
+}
+
+// newTestGroupReconciler returns a LdapGroupReconciler using a fake client
+// holding objs and writing to dir
+func newTestGroupReconciler(t *testing.T, dir ld.Directory, objs ...runtime.Object) *LdapGroupReconciler {
+	return &LdapGroupReconciler{
+		Client:        newTestClient(t, objs...),
+		Log:           ctrl.Log.WithName("controllers").WithName("LdapGroup"),
+		Scheme:        scheme.Scheme,
+		DefaultServer: "default",
+		Recorder:      record.NewFakeRecorder(100),
+		Directory:     dir,
+	}
+}
+
+// recordedEvents returns the events recorded since the last call, as
+// "<type> <reason>"
+func recordedEvents(recorder record.EventRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.(*record.FakeRecorder).Events:
+			fields := strings.SplitN(event, " ", 3)
+			events = append(events, fields[0]+" "+fields[1])
+		default:
+			return events
+		}
+	}
+}
+
+// reconcileUser runs the reconciler for the user and returns it as stored
+// afterwards
+func reconcileUser(t *testing.T, r *LdapUserReconciler, name string) (ldapv1.LdapUser, ctrl.Result, error) {
+	key := types.NamespacedName{Namespace: "default", Name: name}
+	result, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	return getUser(t, r, name), result, err
+}
+
+// getUser returns the user as stored by the fake client
+func getUser(t *testing.T, c client.Client, name string) ldapv1.LdapUser {
+	var user ldapv1.LdapUser
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func testUser(name string) *ldapv1.LdapUser {
+	return &ldapv1.LdapUser{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: ldapv1.LdapUserSpec{
+			Username: name,
+			UID:      "10001",
+			GID:      "10001",
+			Homedir:  "/home/" + name,
+			Shell:    "/bin/bash",
+		},
+	}
+}
+
+func TestMigratePassword(t *testing.T) {
+	user := testUser("user01")
+	user.Spec.Password = "secret"
+	user.Annotations = map[string]string{
+		corev1.LastAppliedConfigAnnotation: `{"kind":"LdapUser","spec":{"username":"user01","password":"secret"}}`,
+	}
+	r := newTestUserReconciler(t, nil, user)
+
+	stored := getUser(t, r, "user01")
+	if err := r.migratePassword(context.Background(), &stored); err != nil {
+		t.Fatal(err)
+	}
+	got := getUser(t, r, "user01")
+	if got.Spec.Password != "" || got.Spec.PasswordSecretRef == nil || got.Spec.PasswordSecretRef.Name != "user01-password" {
+		t.Errorf("spec = %+v, want the password moved to user01-password", got.Spec)
+	}
+	if applied := got.Annotations[corev1.LastAppliedConfigAnnotation]; strings.Contains(applied, "secret") || !strings.Contains(applied, "user01") {
+		t.Errorf("last applied configuration = %s, want it without the password", applied)
+	}
+	var secret corev1.Secret
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "user01-password"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["password"]) != "secret" || !metav1.IsControlledBy(&secret, &got) {
+		t.Errorf("secret = %+v, want the password owned by the user", secret)
+	}
+}
+
+func TestMigratePasswordForeignSecret(t *testing.T) {
+	user := testUser("user01")
+	user.Spec.Password = "secret"
+	foreign := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "user01-password", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("other")},
+	}
+	r := newTestUserReconciler(t, nil, user, foreign)
+
+	stored := getUser(t, r, "user01")
+	if err := r.migratePassword(context.Background(), &stored); err == nil || !strings.Contains(err.Error(), "not owned") {
+		t.Errorf("err = %v, want the foreign secret refused", err)
+	}
+	got := getUser(t, r, "user01")
+	if got.Spec.Password != "secret" || got.Spec.PasswordSecretRef != nil {
+		t.Errorf("spec = %+v, want the inline password kept", got.Spec)
+	}
+	var secret corev1.Secret
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "user01-password"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["password"]) != "other" {
+		t.Errorf("secret data = %s, want it left alone", secret.Data["password"])
+	}
+}
+
+func TestScrubLastApplied(t *testing.T) {
+	user := testUser("user01")
+	user.Annotations = map[string]string{corev1.LastAppliedConfigAnnotation: `{"spec":`}
+	scrubLastApplied(user)
+	if _, ok := user.Annotations[corev1.LastAppliedConfigAnnotation]; ok {
+		t.Errorf("annotations = %v, want the unparsable configuration dropped", user.Annotations)
+	}
+}
+
+func TestUserDrift(t *testing.T) {
+	for _, policy := range []ldapv1.DriftPolicy{ldapv1.DriftPolicyRepair, ldapv1.DriftPolicyReport} {
+		dir := ld.NewMemoryDirectory()
+		user := testUser("user01")
+		user.Spec.DriftPolicy = policy
+		r := newTestUserReconciler(t, dir, testServer.DeepCopy(), user)
+		r.ResyncInterval = time.Minute
+
+		got, _, err := reconcileUser(t, r, "user01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		modReq := ldap.NewModifyRequest(got.Status.DN, nil)
+		modReq.Replace("loginShell", []string{"/bin/sh"})
+		if err := dir.Modify(modReq); err != nil {
+			t.Fatal(err)
+		}
+
+		got, result, err := reconcileUser(t, r, "user01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.RequeueAfter != r.ResyncInterval {
+			t.Errorf("%q: requeue after %s, want %s", policy, result.RequeueAfter, r.ResyncInterval)
+		}
+		if !reflect.DeepEqual(got.Status.Drift, []string{"loginShell"}) {
+			t.Errorf("%q: drift = %v, want [loginShell]", policy, got.Status.Drift)
+		}
+		shell := dir.Entry(got.Status.DN).GetAttributeValue("loginShell")
+		synced := ldapv1.FindCondition(got.Status.Conditions, ldapv1.ConditionSynced)
+		if policy == ldapv1.DriftPolicyReport {
+			if shell != "/bin/sh" {
+				t.Errorf("%q: loginShell = %s, want the drift left in place", policy, shell)
+			}
+			if synced == nil || synced.Status != metav1.ConditionFalse || synced.Reason != reasonDriftDetected {
+				t.Errorf("%q: synced = %+v, want drift reported", policy, synced)
+			}
+		} else {
+			if shell != "/bin/bash" {
+				t.Errorf("%q: loginShell = %s, want it repaired", policy, shell)
+			}
+			if synced == nil || synced.Status != metav1.ConditionTrue {
+				t.Errorf("%q: synced = %+v, want it synced", policy, synced)
+			}
+		}
+	}
+}
+
+func TestUserConflictPerServer(t *testing.T) {
+	older := testUser("user01")
+	older.Namespace = "other"
+	older.UID = "older"
+	user := testUser("user01")
+	user.UID = "newer"
+	user.CreationTimestamp = metav1.NewTime(time.Now())
+	r := newTestUserReconciler(t, nil, older, user)
+	ldc := ld.NewDirectoryClient(ld.Config{BaseDN: "dc=example,dc=com"}, ld.NewMemoryDirectory())
+
+	err := userConflict(context.Background(), r, ldc, user, "default")
+	if _, ok := err.(*conflictError); !ok {
+		t.Errorf("userConflict() = %v, want a conflict on the same server", err)
+	}
+	user.Spec.Server = "other-ldap"
+	if err := userConflict(context.Background(), r, ldc, user, "default"); err != nil {
+		t.Errorf("userConflict() = %v, want none on another server", err)
+	}
+}
+
+// memberIndexClient answers group lists by member like the manager's cache
+// does, as the fake client ignores field selectors
+type memberIndexClient struct {
+	client.Client
+}
+
+func (c memberIndexClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	groups, ok := list.(*ldapv1.LdapGroupList)
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	if !ok || listOpts.FieldSelector == nil {
+		return nil
+	}
+	member, ok := listOpts.FieldSelector.RequiresExactMatch(ldapGroupMemberKey)
+	if !ok {
+		return nil
+	}
+	var items []ldapv1.LdapGroup
+	for _, group := range groups.Items {
+		if containsString(group.Spec.Members, member) {
+			items = append(items, group)
+		}
+	}
+	groups.Items = items
+	return nil
+}
+
+func TestGroupsForUser(t *testing.T) {
+	group := func(name string, members ...string) *ldapv1.LdapGroup {
+		return &ldapv1.LdapGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       ldapv1.LdapGroupSpec{Name: name, Members: members},
+		}
+	}
+	user := testUser("user01")
+	r := &LdapGroupReconciler{
+		Client: memberIndexClient{newTestClient(t,
+			group("byname", "user01"), group("bynumber", "10001"), group("both", "user01", "10001"), group("other", "user02"))},
+		Log: ctrl.Log.WithName("controllers").WithName("LdapGroup"),
+	}
+
+	var got []string
+	for _, req := range r.groupsForUser(handler.MapObject{Meta: user, Object: user}) {
+		got = append(got, req.Name)
+	}
+	sort.Strings(got)
+	if want := []string{"both", "byname", "bynumber"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("groupsForUser() = %v, want %v", got, want)
+	}
+}
+
+func TestGroupResyncOnUIDChange(t *testing.T) {
+	dir := ld.NewMemoryDirectory()
+	user := testUser("user01")
+	user.Generation = 1
+	group := &ldapv1.LdapGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "staff", Namespace: "default"},
+		Spec: ldapv1.LdapGroupSpec{Name: "staff", GID: "20001", Members: []string{"user01"},
+			Schema: &ldapv1.GroupSchema{MemberUIDFormat: ldapv1.MemberUIDNumber}},
+	}
+	r := newTestUserReconciler(t, dir, testServer.DeepCopy(), user, group)
+	gr := newTestGroupReconciler(t, dir)
+	gr.Client = r.Client
+	reconcileGroup := func() []string {
+		if _, err := gr.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "staff"}}); err != nil {
+			t.Fatal(err)
+		}
+		return dir.Entry("cn=staff,ou=Groups,dc=example,dc=com").GetAttributeValues("memberUid")
+	}
+
+	if _, _, err := reconcileUser(t, r, "user01"); err != nil {
+		t.Fatal(err)
+	}
+	if got := reconcileGroup(); !reflect.DeepEqual(got, []string{"10001"}) {
+		t.Fatalf("memberUid = %v, want [10001]", got)
+	}
+
+	written := getUser(t, r, "user01")
+	changed := written.DeepCopy()
+	changed.Spec.UID = "10005"
+	changed.Generation = 2
+	if err := r.Update(context.Background(), changed); err != nil {
+		t.Fatal(err)
+	}
+	// the group would still find the old number in LDAP
+	if userWritten(&written, changed) {
+		t.Error("userWritten() = true for a spec change not yet written")
+	}
+
+	got, _, err := reconcileUser(t, r, "user01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !userWritten(changed, &got) {
+		t.Error("userWritten() = false once the new uid is written")
+	}
+	if got := reconcileGroup(); !reflect.DeepEqual(got, []string{"10005"}) {
+		t.Errorf("memberUid = %v, want [10005]", got)
+	}
+}
+
+func TestUserEvents(t *testing.T) {
+	dir := ld.NewMemoryDirectory()
+	adopted := testUser("adopted")
+	adopted.Spec.UID = "10002"
+	adopted.Annotations = map[string]string{ldapv1.AdoptAnnotation: "true"}
+	legacy := adopted.Spec
+	legacy.OU = "ou=Legacy"
+	broken := testUser("broken")
+	broken.Spec.UID = "10003"
+	broken.Spec.PasswordSecretRef = &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "password"}
+	r := newTestUserReconciler(t, dir, testServer.DeepCopy(), testUser("user01"), adopted, broken)
+	ldc := ld.NewDirectoryClient(ld.Config{BaseDN: testServer.Spec.BaseDN}, dir)
+	if _, _, err := ldc.AddUser(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want [][]string
+	}{
+		// nothing is recorded again when nothing changed
+		{"user01", [][]string{{"Normal Created"}, nil}},
+		{"adopted", [][]string{{"Normal Adopted"}, nil}},
+		{"broken", [][]string{{"Warning PasswordError"}, nil}},
+	}
+	for _, tt := range tests {
+		for i, want := range tt.want {
+			reconcileUser(t, r, tt.name)
+			if got := recordedEvents(r.Recorder); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: reconcile %d recorded %v, want %v", tt.name, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestGroupEvents(t *testing.T) {
+	group := &ldapv1.LdapGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "admins", Namespace: "default"},
+		Spec:       ldapv1.LdapGroupSpec{Name: "admins", GID: "20001", Members: []string{"ghost"}},
+	}
+	r := newTestGroupReconciler(t, ld.NewMemoryDirectory(), testServer.DeepCopy(), group)
+	key := types.NamespacedName{Namespace: "default", Name: "admins"}
+
+	for i, want := range [][]string{{"Warning MemberNotFound", "Normal Created"}, nil} {
+		if _, err := r.Reconcile(ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatal(err)
+		}
+		if got := recordedEvents(r.Recorder); !reflect.DeepEqual(got, want) {
+			t.Errorf("reconcile %d recorded %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestAdoptUser(t *testing.T) {
+	dir := ld.NewMemoryDirectory()
+	ldc := ld.NewDirectoryClient(ld.Config{BaseDN: testServer.Spec.BaseDN}, dir)
+	if _, _, err := ldc.AddUser(ldapv1.LdapUserSpec{Username: "olduser", UID: "500", GID: "500", Homedir: "/export/olduser", Shell: "/bin/ksh", OU: "ou=Legacy"}); err != nil {
+		t.Fatal(err)
+	}
+	// defaulted by the webhook before the adopt annotation was added
+	user := &ldapv1.LdapUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "olduser", Namespace: "default"},
+		Spec:       ldapv1.LdapUserSpec{Username: "olduser"},
+	}
+	user.Default()
+	user.Annotations[ldapv1.AdoptAnnotation] = "true"
+	r := newTestUserReconciler(t, dir, testServer.DeepCopy(), user)
+
+	got, _, err := reconcileUser(t, r, "olduser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Spec.Homedir != "/export/olduser" || got.Spec.Shell != "/bin/ksh" || got.Spec.Gecos != "olduser" {
+		t.Errorf("spec = %+v, want the entry's values", got.Spec)
+	}
+	if _, ok := got.Annotations[ldapv1.DefaultedAnnotation]; ok || !got.Status.Managed {
+		t.Errorf("annotations = %v, managed = %v", got.Annotations, got.Status.Managed)
+	}
+	if shell := dir.Entry("uid=olduser,ou=Legacy,dc=example,dc=com").GetAttributeValue("loginShell"); shell != "/bin/ksh" {
+		t.Errorf("loginShell = %s, want it kept", shell)
+	}
+}
+
+func TestUserOwnership(t *testing.T) {
+	dir := ld.NewMemoryDirectory()
+	ldc := ld.NewDirectoryClient(ld.Config{BaseDN: testServer.Spec.BaseDN}, dir)
+	// written before the status recorded the entry as managed
+	old := testUser("old")
+	old.Spec.UID = "10002"
+	old.Status.CreatedOn = "2021-01-01 00:00:00"
+	if _, _, err := ldc.AddUser(old.Spec); err != nil {
+		t.Fatal(err)
+	}
+	// someone else's entry with the same name
+	foreign := testUser("foreign")
+	foreign.Spec.UID = "10004"
+	other := foreign.Spec
+	other.UID = "20004"
+	if _, _, err := ldc.AddUser(other); err != nil {
+		t.Fatal(err)
+	}
+	// an unmanaged entry whose name and numbers anyone can read and copy
+	matching := testUser("matching")
+	matching.Spec.UID = "10003"
+	matching.Spec.Password = "takeover"
+	unmanaged := matching.Spec
+	unmanaged.Password = "original"
+	unmanaged.Shell = "/bin/ksh"
+	if _, _, err := ldc.AddUser(unmanaged); err != nil {
+		t.Fatal(err)
+	}
+	matchingDN := "uid=matching,ou=People,dc=example,dc=com"
+	before := dir.Entry(matchingDN)
+	r := newTestUserReconciler(t, dir, testServer.DeepCopy(), old, matching, foreign)
+
+	for _, tt := range []struct {
+		name     string
+		conflict bool
+	}{
+		{"old", false},
+		{"matching", true},
+		{"foreign", true},
+	} {
+		got, _, err := reconcileUser(t, r, tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isConflicted(got.Status.Conditions) != tt.conflict || got.Status.Managed == tt.conflict {
+			t.Errorf("%s: conflict = %v, managed = %v, want conflict %v", tt.name, isConflicted(got.Status.Conditions), got.Status.Managed, tt.conflict)
+		}
+	}
+	if after := dir.Entry(matchingDN); !reflect.DeepEqual(after, before) {
+		t.Errorf("entry = %+v, want it left as %+v", after, before)
+	}
+}
+
+func TestGroupOwnership(t *testing.T) {
+	dir := ld.NewMemoryDirectory()
+	ldc := ld.NewDirectoryClient(ld.Config{BaseDN: testServer.Spec.BaseDN}, dir)
+	if _, _, err := ldc.AddGroup(ldapv1.LdapGroupSpec{Name: "admins", GID: "20001", Members: []string{"root"}}); err != nil {
+		t.Fatal(err)
+	}
+	groupDN := "cn=admins,ou=Groups,dc=example,dc=com"
+	before := dir.Entry(groupDN)
+	// same name and gid, without the adopt annotation
+	group := &ldapv1.LdapGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "admins", Namespace: "default"},
+		Spec:       ldapv1.LdapGroupSpec{Name: "admins", GID: "20001", Members: []string{"tenant"}},
+	}
+	r := newTestGroupReconciler(t, dir, testServer.DeepCopy(), group)
+	key := types.NamespacedName{Namespace: "default", Name: "admins"}
+
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	var got ldapv1.LdapGroup
+	if err := r.Get(context.Background(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !isConflicted(got.Status.Conditions) || got.Status.Managed {
+		t.Errorf("conflict = %v, managed = %v, want a conflict", isConflicted(got.Status.Conditions), got.Status.Managed)
+	}
+	if after := dir.Entry(groupDN); !reflect.DeepEqual(after, before) {
+		t.Errorf("entry = %+v, want it left as %+v", after, before)
+	}
+}
+
+func TestUserDeletionWithoutServer(t *testing.T) {
+	deleting := func(name string, policy ldapv1.DeletionPolicy) *ldapv1.LdapUser {
+		user := testUser(name)
+		user.Spec.DeletionPolicy = policy
+		user.Finalizers = []string{"ldap.digitalis.io/finalizer"}
+		now := metav1.Now()
+		user.DeletionTimestamp = &now
+		user.Status.Managed = true
+		return user
+	}
+	// the LdapServer is gone, and the Retain one needs no connection at all
+	r := newTestUserReconciler(t, nil, deleting("user01", ""), deleting("retained", ldapv1.DeletionPolicyRetain))
+
+	for _, tt := range []struct {
+		name  string
+		event string
+	}{
+		{"user01", "Warning " + reasonServerUnavailable},
+		{"retained", "Normal " + eventRetained},
+	} {
+		got, _, err := reconcileUser(t, r, tt.name)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(got.Finalizers) != 0 {
+			t.Errorf("%s: finalizers = %v, want ours removed", tt.name, got.Finalizers)
+		}
+		if events := recordedEvents(r.Recorder); !reflect.DeepEqual(events, []string{tt.event}) {
+			t.Errorf("%s: recorded %v, want %s", tt.name, events, tt.event)
+		}
+	}
+}
+
+func TestUserDeletionWithoutBindSecret(t *testing.T) {
+	server := testServer.DeepCopy()
+	server.Spec.BindPasswordSecretRef = ldapv1.SecretKeyReference{Namespace: "default", Name: "ldap-bind", Key: "password"}
+	user := testUser("user01")
+	user.Finalizers = []string{"ldap.digitalis.io/finalizer"}
+	now := metav1.Now()
+	user.DeletionTimestamp = &now
+	user.Status.Managed = true
+	// connects to the server, which needs the missing bind Secret
+	r := newTestUserReconciler(t, nil, server, user)
+
+	got, _, err := reconcileUser(t, r, "user01")
+	if err == nil {
+		t.Error("reconcile succeeded without the bind secret")
+	}
+	if !reflect.DeepEqual(got.Finalizers, user.Finalizers) {
+		t.Errorf("finalizers = %v, want ours kept", got.Finalizers)
+	}
+	if degraded := ldapv1.FindCondition(got.Status.Conditions, ldapv1.ConditionDegraded); degraded == nil || degraded.Reason != reasonServerUnavailable {
+		t.Errorf("degraded = %+v, want %s", degraded, reasonServerUnavailable)
+	}
+	if events := recordedEvents(r.Recorder); !reflect.DeepEqual(events, []string{"Warning " + reasonServerUnavailable}) {
+		t.Errorf("recorded %v, want the failure", events)
+	}
+}
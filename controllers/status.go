@@ -0,0 +1,217 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+)
+
+// Reasons used in the status conditions
+const (
+	reasonSynced            = "Synced"
+	reasonEntryExists       = "EntryExists"
+	reasonEntryMissing      = "EntryMissing"
+	reasonServerUnavailable = "ServerUnavailable"
+	reasonPasswordError     = "PasswordError"
+	reasonSSHKeyError       = "SSHKeyError"
+	reasonLdapError         = "LdapError"
+	reasonDriftDetected     = "DriftDetected"
+	reasonDriftRepaired     = "DriftRepaired"
+	reasonIDAllocation      = "IDAllocationFailed"
+	reasonConflict          = "Conflict"
+	reasonUnique            = "Unique"
+)
+
+// driftEntry is reported as drift when the entry is missing altogether
+const driftEntry = "entry"
+
+const timeFormat = "2006-01-02 15:04:05"
+
+// setSynced records a successful reconcile, listing the attributes that were
+// repaired if any drifted
+func setSynced(conditions *[]ldapv1.Condition, generation int64, drift []string) {
+	reason, message := reasonSynced, ""
+	if len(drift) != 0 {
+		reason = reasonDriftRepaired
+		message = fmt.Sprintf("repaired changes made in LDAP to %s", strings.Join(drift, ", "))
+	}
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reasonEntryExists,
+	})
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionSynced,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             reasonSynced,
+	})
+}
+
+// setFailed records a failed reconcile. ready tells whether the entry is
+// known to exist in LDAP.
+func setFailed(conditions *[]ldapv1.Condition, generation int64, ready metav1.ConditionStatus, reason string, err error) {
+	readyReason := reason
+	switch ready {
+	case metav1.ConditionTrue:
+		readyReason = reasonEntryExists
+	case metav1.ConditionFalse:
+		readyReason = reasonEntryMissing
+	}
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionReady,
+		Status:             ready,
+		ObservedGeneration: generation,
+		Reason:             readyReason,
+	})
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionSynced,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            err.Error(),
+	})
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            err.Error(),
+	})
+}
+
+// isNewFailure tells whether the failure isn't the one already recorded in
+// the Degraded condition, so a failure that persists is only reported once
+func isNewFailure(conditions []ldapv1.Condition, reason string, err error) bool {
+	degraded := ldapv1.FindCondition(conditions, ldapv1.ConditionDegraded)
+	return degraded == nil || degraded.Status != metav1.ConditionTrue || degraded.Reason != reason || degraded.Message != err.Error()
+}
+
+// setDrifted records changes made in LDAP that were not repaired
+func setDrifted(conditions *[]ldapv1.Condition, generation int64, drift []string) {
+	ready, readyReason := metav1.ConditionTrue, reasonEntryExists
+	if len(drift) == 1 && drift[0] == driftEntry {
+		ready, readyReason = metav1.ConditionFalse, reasonEntryMissing
+	}
+	message := fmt.Sprintf("changed in LDAP: %s", strings.Join(drift, ", "))
+
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionReady,
+		Status:             ready,
+		ObservedGeneration: generation,
+		Reason:             readyReason,
+	})
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionSynced,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             reasonDriftDetected,
+		Message:            message,
+	})
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             reasonDriftDetected,
+	})
+}
+
+// setConflict records that the object clashes with another one, or with an
+// entry in LDAP, and was not written
+func setConflict(conditions *[]ldapv1.Condition, generation int64, err error) {
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionConflict,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reasonConflict,
+		Message:            err.Error(),
+	})
+	setFailed(conditions, generation, metav1.ConditionUnknown, reasonConflict, err)
+}
+
+// setUnique clears the Conflict condition
+func setUnique(conditions *[]ldapv1.Condition, generation int64) {
+	ldapv1.SetCondition(conditions, ldapv1.Condition{
+		Type:               ldapv1.ConditionConflict,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             reasonUnique,
+	})
+}
+
+// isConflicted tells whether the object was refused because of a conflict,
+// in which case the LDAP entry belongs to someone else
+func isConflicted(conditions []ldapv1.Condition) bool {
+	conflict := ldapv1.FindCondition(conditions, ldapv1.ConditionConflict)
+	return conflict != nil && conflict.Status == metav1.ConditionTrue
+}
+
+// ownsEntry tells from the status whether the controller wrote the entry.
+// Objects from before the managed field only have a DN, or only the time they
+// were created.
+func ownsEntry(managed bool, dn string, createdOn string) bool {
+	return managed || dn != "" || createdOn != ""
+}
+
+// isResync tells whether the current generation was already applied, so
+// differences found in LDAP were made outside of the controller
+func isResync(conditions []ldapv1.Condition, generation int64) bool {
+	synced := ldapv1.FindCondition(conditions, ldapv1.ConditionSynced)
+	if synced == nil || synced.ObservedGeneration != generation {
+		return false
+	}
+	return synced.Status == metav1.ConditionTrue || synced.Reason == reasonDriftDetected
+}
+
+// setExpiry records when the account expires and how many days are left,
+// counted in whole days as shadowExpire is
+func setExpiry(status *ldapv1.LdapUserStatus, expiresOn string, now time.Time) {
+	expiry, err := time.Parse(ldapv1.ExpiryDateFormat, expiresOn)
+	if err != nil {
+		status.Expiry, status.DaysRemaining = nil, nil
+		return
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	days := int64(expiry.Sub(today) / (24 * time.Hour))
+	status.Expiry = &metav1.Time{Time: expiry}
+	status.DaysRemaining = &days
+}
+
+// entryExists turns the result of a lookup into a Ready status
+func entryExists(found bool, err error) metav1.ConditionStatus {
+	switch {
+	case err != nil:
+		return metav1.ConditionUnknown
+	case found:
+		return metav1.ConditionTrue
+	}
+	return metav1.ConditionFalse
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+)
+
+// conditionStatuses returns the Ready, Synced and Degraded statuses
+func conditionStatuses(conditions []ldapv1.Condition) []metav1.ConditionStatus {
+	var statuses []metav1.ConditionStatus
+	for _, conditionType := range []string{ldapv1.ConditionReady, ldapv1.ConditionSynced, ldapv1.ConditionDegraded} {
+		condition := ldapv1.FindCondition(conditions, conditionType)
+		if condition == nil {
+			statuses = append(statuses, "")
+			continue
+		}
+		statuses = append(statuses, condition.Status)
+	}
+	return statuses
+}
+
+func TestSetFailedAndSynced(t *testing.T) {
+	var conditions []ldapv1.Condition
+	setFailed(&conditions, 1, metav1.ConditionFalse, reasonLdapError, errors.New("no such object"))
+	if got := conditionStatuses(conditions); got[0] != metav1.ConditionFalse || got[1] != metav1.ConditionFalse || got[2] != metav1.ConditionTrue {
+		t.Errorf("after setFailed() = %v", got)
+	}
+	if ready := ldapv1.FindCondition(conditions, ldapv1.ConditionReady); ready.Reason != reasonEntryMissing {
+		t.Errorf("Ready reason = %s, want %s", ready.Reason, reasonEntryMissing)
+	}
+	if degraded := ldapv1.FindCondition(conditions, ldapv1.ConditionDegraded); degraded.Reason != reasonLdapError || degraded.Message != "no such object" {
+		t.Errorf("Degraded = %+v, want the error", degraded)
+	}
+
+	setSynced(&conditions, 2, nil)
+	if got := conditionStatuses(conditions); got[0] != metav1.ConditionTrue || got[1] != metav1.ConditionTrue || got[2] != metav1.ConditionFalse {
+		t.Errorf("after setSynced() = %v", got)
+	}
+	for _, condition := range conditions {
+		if condition.ObservedGeneration != 2 || condition.Message != "" {
+			t.Errorf("%s = %+v, want generation 2 without message", condition.Type, condition)
+		}
+	}
+}
+
+func TestSetDrifted(t *testing.T) {
+	var conditions []ldapv1.Condition
+	setDrifted(&conditions, 1, []string{"loginShell"})
+	if got := conditionStatuses(conditions); got[0] != metav1.ConditionTrue || got[1] != metav1.ConditionFalse || got[2] != metav1.ConditionFalse {
+		t.Errorf("after setDrifted() = %v", got)
+	}
+	if synced := ldapv1.FindCondition(conditions, ldapv1.ConditionSynced); synced.Reason != reasonDriftDetected || synced.Message != "changed in LDAP: loginShell" {
+		t.Errorf("Synced = %+v, want the drift reported", synced)
+	}
+	if !isResync(conditions, 1) || isResync(conditions, 2) {
+		t.Error("isResync() should hold for reported drift of the same generation only")
+	}
+
+	setDrifted(&conditions, 1, []string{driftEntry})
+	if ready := ldapv1.FindCondition(conditions, ldapv1.ConditionReady); ready.Status != metav1.ConditionFalse || ready.Reason != reasonEntryMissing {
+		t.Errorf("Ready = %+v, want the missing entry reported", ready)
+	}
+
+	setSynced(&conditions, 1, []string{"loginShell", "gecos"})
+	if synced := ldapv1.FindCondition(conditions, ldapv1.ConditionSynced); synced.Status != metav1.ConditionTrue || synced.Reason != reasonDriftRepaired || synced.Message != "repaired changes made in LDAP to loginShell, gecos" {
+		t.Errorf("Synced = %+v, want the repair reported", synced)
+	}
+}
+
+func TestIsResync(t *testing.T) {
+	var conditions []ldapv1.Condition
+	if isResync(conditions, 1) {
+		t.Error("isResync() without conditions = true")
+	}
+	setFailed(&conditions, 1, metav1.ConditionTrue, reasonLdapError, errors.New("busy"))
+	if isResync(conditions, 1) {
+		t.Error("isResync() after a failure = true, want the spec applied again")
+	}
+	setSynced(&conditions, 1, nil)
+	if !isResync(conditions, 1) {
+		t.Error("isResync() after a sync = false")
+	}
+	if isResync(conditions, 2) {
+		t.Error("isResync() for a new generation = true")
+	}
+}
+
+func TestEntryExists(t *testing.T) {
+	tests := []struct {
+		found bool
+		err   error
+		want  metav1.ConditionStatus
+	}{
+		{true, nil, metav1.ConditionTrue},
+		{false, nil, metav1.ConditionFalse},
+		{false, errors.New("connection refused"), metav1.ConditionUnknown},
+	}
+	for _, tt := range tests {
+		if got := entryExists(tt.found, tt.err); got != tt.want {
+			t.Errorf("entryExists(%t, %v) = %s, want %s", tt.found, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSetExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 30, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expiresOn string
+		want      int64
+	}{
+		{"2024-01-31", 1},
+		{"2024-01-30", 0},
+		{"2024-01-01", -29},
+	}
+	for _, tt := range tests {
+		var status ldapv1.LdapUserStatus
+		setExpiry(&status, tt.expiresOn, now)
+		if status.Expiry == nil || status.Expiry.Format(ldapv1.ExpiryDateFormat) != tt.expiresOn ||
+			status.DaysRemaining == nil || *status.DaysRemaining != tt.want {
+			t.Errorf("setExpiry(%s) = %v, %v, want %d days", tt.expiresOn, status.Expiry, status.DaysRemaining, tt.want)
+		}
+	}
+
+	status := ldapv1.LdapUserStatus{DaysRemaining: new(int64)}
+	setExpiry(&status, "", now)
+	if status.Expiry != nil || status.DaysRemaining != nil {
+		t.Errorf("setExpiry() without a date = %v, %v", status.Expiry, status.DaysRemaining)
+	}
+}
@@ -17,13 +17,18 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/controller-runtime/pkg/envtest/printer"
@@ -31,6 +36,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	ldapv1 "ldap-accounts-controller/api/v1"
+	ld "ldap-accounts-controller/ldap"
+	"ldap-accounts-controller/ldap/ldaptest"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -41,6 +48,15 @@ var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
 
+// ldapServer is the in-process LDAP server the reconcilers talk to
+var ldapServer *ldaptest.Server
+var stopManager chan struct{}
+
+const (
+	testBaseDN  = "dc=digitalis,dc=io"
+	testTimeout = 10 * time.Second
+)
+
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -74,11 +90,72 @@ var _ = BeforeSuite(func(done Done) {
 	Expect(err).ToNot(HaveOccurred())
 	Expect(k8sClient).ToNot(BeNil())
 
+	By("starting the LDAP server")
+	ldapServer, err = ldaptest.NewServer("cn=admin,"+testBaseDN, "letmein")
+	Expect(err).ToNot(HaveOccurred())
+
+	ctx := context.Background()
+	Expect(k8sClient.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ldap-admin", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte(ldapServer.BindPassword)},
+	})).To(Succeed())
+	Expect(k8sClient.Create(ctx, &ldapv1.LdapServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: ldapv1.LdapServerSpec{
+			Host:   ldapServer.Host,
+			Port:   int32(ldapServer.Port),
+			BaseDN: testBaseDN,
+			BindDN: ldapServer.BindDN,
+			BindPasswordSecretRef: ldapv1.SecretKeyReference{
+				Name:      "ldap-admin",
+				Namespace: "default",
+				Key:       "password",
+			},
+		},
+	})).To(Succeed())
+
+	By("starting the controllers")
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             scheme.Scheme,
+		MetricsBindAddress: "0",
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	ldapClients := ld.NewClientCache(2)
+	Expect((&LdapGroupReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("LdapGroup"),
+		Scheme:        mgr.GetScheme(),
+		DefaultServer: "default",
+		LdapClients:   ldapClients,
+		Recorder:      mgr.GetEventRecorderFor("ldapgroup-controller"),
+	}).SetupWithManager(mgr)).To(Succeed())
+	Expect((&LdapUserReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("LdapUser"),
+		Scheme:        mgr.GetScheme(),
+		DefaultServer: "default",
+		LdapClients:   ldapClients,
+		Recorder:      mgr.GetEventRecorderFor("ldapuser-controller"),
+	}).SetupWithManager(mgr)).To(Succeed())
+
+	stopManager = make(chan struct{})
+	go func() {
+		defer GinkgoRecover()
+		Expect(mgr.Start(stopManager)).To(Succeed())
+	}()
+
 	close(done)
 }, 60)
 
 var _ = AfterSuite(func() {
 	By("tearing down the test environment")
+	if stopManager != nil {
+		close(stopManager)
+	}
+	if ldapServer != nil {
+		ldapServer.Close()
+	}
 	err := testEnv.Stop()
 	Expect(err).ToNot(HaveOccurred())
 })
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+
+	ldap "github.com/go-ldap/ldap/v3"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+)
+
+// AdoptUser returns user with the fields it leaves blank filled in from the
+// existing entry, and whether there is one. The password is never read back.
+func (c *Client) AdoptUser(user ldapv1.LdapUserSpec) (ldapv1.LdapUserSpec, bool, error) {
+	entry, err := c.userEntry(user.Username)
+	if err != nil || entry == nil {
+		return user, false, err
+	}
+
+	user.UID = firstNonEmpty(user.UID, entry.GetAttributeValue("uidNumber"))
+	user.GID = firstNonEmpty(user.GID, entry.GetAttributeValue("gidNumber"))
+	user.Homedir = firstNonEmpty(user.Homedir, entry.GetAttributeValue("homeDirectory"))
+	user.Shell = firstNonEmpty(user.Shell, entry.GetAttributeValue("loginShell"))
+	user.Gecos = firstNonEmpty(user.Gecos, entry.GetAttributeValue("gecos"), entry.GetAttributeValue("cn"))
+	if user.ExpiresOn == "" {
+		user.ExpiresOn = shadowDate(entry.GetAttributeValue("shadowExpire"))
+	}
+	if user.PasswordMaxAge == nil {
+		user.PasswordMaxAge = parseDays(entry.GetAttributeValue("shadowMax"))
+	}
+	if user.PasswordMinAge == nil {
+		user.PasswordMinAge = parseDays(entry.GetAttributeValue("shadowMin"))
+	}
+	if user.PasswordWarningDays == nil {
+		user.PasswordWarningDays = parseDays(entry.GetAttributeValue("shadowWarning"))
+	}
+	if user.PasswordInactiveDays == nil {
+		user.PasswordInactiveDays = parseDays(entry.GetAttributeValue("shadowInactive"))
+	}
+	if len(user.SSHPublicKeys) == 0 && len(user.SSHPublicKeysFrom) == 0 {
+		user.SSHPublicKeys = attrValues(entry.GetAttributeValues("sshPublicKey")...)
+	}
+	if user.OU == "" {
+		// keep the entry where it is when the layout would move it
+		if dn, err := c.userDN(user); err == nil && !sameDN(dn, entry.DN) {
+			user.OU = ouOf(entry.DN, c.config.BaseDN)
+		}
+	}
+	return user, true, nil
+}
+
+// AdoptGroup returns group with the fields it leaves blank filled in from the
+// existing entry, and whether there is one
+func (c *Client) AdoptGroup(group ldapv1.LdapGroupSpec) (ldapv1.LdapGroupSpec, bool, error) {
+	entry, err := c.groupEntry(group.Name)
+	if err != nil || entry == nil {
+		return group, false, err
+	}
+
+	group.GID = firstNonEmpty(group.GID, entry.GetAttributeValue("gidNumber"))
+	if len(group.Members) == 0 {
+		if group.Members, err = c.entryMembers(entry); err != nil {
+			return group, true, err
+		}
+	}
+	if group.OU == "" {
+		if dn, err := c.groupDN(group); err == nil && !sameDN(dn, entry.DN) {
+			group.OU = ouOf(entry.DN, c.config.BaseDN)
+		}
+	}
+	return group, true, nil
+}
+
+// entryMembers returns the usernames a group entry lists, in memberUid or as
+// the DNs of their entries in member and uniqueMember. The group's own DN,
+// listed by empty groups, and DNs of entries that no longer exist are
+// skipped.
+func (c *Client) entryMembers(entry *ldap.Entry) ([]string, error) {
+	members := attrValues(entry.GetAttributeValues("memberUid")...)
+	for _, dn := range append(entry.GetAttributeValues("member"), entry.GetAttributeValues("uniqueMember")...) {
+		if sameDN(dn, entry.DN) {
+			continue
+		}
+		result, err := c.dir.Search(ldap.NewSearchRequest(
+			dn,
+			ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+			"(objectClass=*)",
+			[]string{"uid"},
+			nil))
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to look up member %s. %w", dn, err)
+		}
+		if len(result.Entries) == 0 {
+			continue
+		}
+		uid := result.Entries[0].GetAttributeValue("uid")
+		if uid == "" {
+			return nil, fmt.Errorf("member %s of group %s has no uid, list the members in the spec to adopt it", dn, entry.GetAttributeValue("cn"))
+		}
+		if !containsFold(members, uid) {
+			members = append(members, uid)
+		}
+	}
+	return members, nil
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testCA returns a self-signed CA as PEM and a server certificate for
+// 127.0.0.1 signed by it
+func testCA(t *testing.T) ([]byte, tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	return caPEM, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func ldapResult(id int64, tag ber.Tag, code int64) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	packet.AppendChild(response)
+	return packet
+}
+
+// serveBind answers simple binds and StartTLS on a single connection, which
+// is all Connect needs
+func serveBind(conn net.Conn, cert tls.Certificate) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		switch packet.Children[1].Tag {
+		case ldap.ApplicationBindRequest:
+			conn.Write(ldapResult(id, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationExtendedRequest:
+			conn.Write(ldapResult(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess).Bytes())
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+		default:
+			return
+		}
+	}
+}
+
+func listen(t *testing.T, cert tls.Certificate, implicitTLS bool) (net.Listener, string, int) {
+	var l net.Listener
+	var err error
+	if implicitTLS {
+		l, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveBind(conn, cert)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return l, host, p
+}
+
+func TestConnectTLSModes(t *testing.T) {
+	caPEM, cert := testCA(t)
+	otherCA, _ := testCA(t)
+
+	tests := []struct {
+		name        string
+		implicitTLS bool
+		config      Config
+		wantErr     bool
+	}{
+		{name: "plain", config: Config{}},
+		{name: "ldaps", implicitTLS: true, config: Config{TLS: true, TLSCA: caPEM}},
+		{name: "starttls", config: Config{TLS: true, StartTLS: true, TLSCA: caPEM}},
+		{name: "ldaps untrusted", implicitTLS: true, config: Config{TLS: true, TLSCA: otherCA}, wantErr: true},
+		{name: "starttls untrusted", config: Config{TLS: true, StartTLS: true, TLSCA: otherCA}, wantErr: true},
+		{name: "ldaps insecure", implicitTLS: true, config: Config{TLS: true, TLSInsecure: true}},
+		{name: "bad ca", implicitTLS: true, config: Config{TLS: true, TLSCA: []byte("garbage")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.config
+			l, host, port := listen(t, cert, tt.implicitTLS)
+			defer l.Close()
+			cfg.Hostname, cfg.Port = host, port
+			cfg.BindDN = "cn=admin,dc=digitalis,dc=io"
+			cfg.BindPassword = "letmein"
+
+			conn, err := Connect(cfg)
+			if tt.wantErr {
+				if err == nil {
+					conn.Close()
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+		})
+	}
+}
+
+func TestConnectMetrics(t *testing.T) {
+	_, cert := testCA(t)
+	l, host, port := listen(t, cert, false)
+	defer l.Close()
+
+	before := testutil.ToFloat64(operationsTotal.WithLabelValues(opBind, "Success"))
+	conn, err := Connect(Config{Hostname: host, Port: port, BindDN: "cn=admin", BindPassword: "letmein"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if got := testutil.ToFloat64(operationsTotal.WithLabelValues(opBind, "Success")); got != before+1 {
+		t.Errorf("bind successes = %v, want %v", got, before+1)
+	}
+}
+
+func TestResultCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "Success"},
+		{ldap.NewError(ldap.LDAPResultEntryAlreadyExists, errors.New("exists")), "Entry Already Exists"},
+		{fmt.Errorf("Could not connect to ldap server %w", &BindError{Err: ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("bad"))}), "Invalid Credentials"},
+		{errPoolClosed, "Other"},
+	}
+	for _, tt := range tests {
+		if got := resultCode(tt.err); got != tt.want {
+			t.Errorf("resultCode(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+)
+
+// Disabled accounts get an expiry in the past, which also keeps them out of
+// groups, and a shell refusing logins
+const (
+	disabledShadowExpire = "1"
+	disabledShell        = "/sbin/nologin"
+)
+
+// deletionPolicy returns the object's policy, or the server's
+func (c *Client) deletionPolicy(policy ldapv1.DeletionPolicy) ldapv1.DeletionPolicy {
+	if policy == "" {
+		policy = c.config.DeletionPolicy
+	}
+	if policy == "" {
+		policy = ldapv1.DeletionPolicyDelete
+	}
+	return policy
+}
+
+// RemoveUser applies the user's deletion policy to its entry and returns the
+// policy applied
+func (c *Client) RemoveUser(user ldapv1.LdapUserSpec) (ldapv1.DeletionPolicy, error) {
+	policy := c.deletionPolicy(user.DeletionPolicy)
+	switch policy {
+	case ldapv1.DeletionPolicyRetain:
+		return policy, nil
+	case ldapv1.DeletionPolicyDisable:
+		return policy, c.DisableUser(user)
+	}
+	return policy, c.DeleteUser(user)
+}
+
+// RemoveGroup applies the group's deletion policy to its entry and returns
+// the policy applied
+func (c *Client) RemoveGroup(group ldapv1.LdapGroupSpec) (ldapv1.DeletionPolicy, error) {
+	policy := c.deletionPolicy(group.DeletionPolicy)
+	switch policy {
+	case ldapv1.DeletionPolicyRetain:
+		return policy, nil
+	case ldapv1.DeletionPolicyDisable:
+		return policy, c.DisableGroup(group)
+	}
+	return policy, c.DeleteGroup(group)
+}
+
+// DisableUser locks the account and removes it from every group listing it
+func (c *Client) DisableUser(user ldapv1.LdapUserSpec) error {
+	if user.Username == "" {
+		return nil
+	}
+	entry, err := c.userEntry(user.Username)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	modReq := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
+	modReq.Replace("shadowExpire", []string{disabledShadowExpire})
+	modReq.Replace("loginShell", []string{disabledShell})
+	if err := c.modifyEntry(modReq); err != nil {
+		return err
+	}
+
+	uid := entry.GetAttributeValue("uid")
+	uidNumber := entry.GetAttributeValue("uidNumber")
+	search := ldap.NewSearchRequest(
+		c.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf("(&(objectClass=posixGroup)(|(memberUid=%s)(memberUid=%s)(member=%s)(uniqueMember=%s)))",
+			ldap.EscapeFilter(uid), ldap.EscapeFilter(uidNumber), ldap.EscapeFilter(entry.DN), ldap.EscapeFilter(entry.DN)),
+		[]string{"memberUid", "member", "uniqueMember"},
+		nil)
+	result, err := c.dir.Search(search)
+	if err != nil {
+		return fmt.Errorf("Failed to search groups. %w", err)
+	}
+	for _, group := range result.Entries {
+		modReq := ldap.NewModifyRequest(group.DN, []ldap.Control{})
+		if values := group.GetEqualFoldAttributeValues("memberUid"); len(values) != 0 {
+			modReq.Replace("memberUid", without(values, func(v string) bool { return strings.EqualFold(v, uid) || v == uidNumber }))
+		}
+		for _, name := range []string{"member", "uniqueMember"} {
+			values := group.GetEqualFoldAttributeValues(name)
+			if len(values) == 0 {
+				continue
+			}
+			// the attribute is required, an empty group lists itself
+			rest := without(values, func(v string) bool { return sameDN(v, entry.DN) })
+			if len(rest) == 0 {
+				rest = []string{group.DN}
+			}
+			modReq.Replace(name, rest)
+		}
+		if err := c.modifyEntry(modReq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisableGroup removes every member from the group
+func (c *Client) DisableGroup(group ldapv1.LdapGroupSpec) error {
+	entry, err := c.groupEntry(group.Name)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	modReq := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
+	if len(entry.GetEqualFoldAttributeValues("memberUid")) != 0 {
+		modReq.Delete("memberUid", []string{})
+	}
+	for _, name := range []string{"member", "uniqueMember"} {
+		if len(entry.GetEqualFoldAttributeValues(name)) != 0 {
+			modReq.Replace(name, []string{entry.DN})
+		}
+	}
+	return c.modifyEntry(modReq)
+}
+
+// isDisabled tells whether the account was locked by DisableUser
+func isDisabled(entry *ldap.Entry) bool {
+	return entry.GetAttributeValue("shadowExpire") == disabledShadowExpire
+}
+
+func without(values []string, drop func(string) bool) []string {
+	var out []string
+	for _, v := range values {
+		if !drop(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
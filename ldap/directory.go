@@ -0,0 +1,36 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// Directory is the set of LDAP operations the account functions need. Pool
+// runs them against a server, MemoryDirectory keeps the entries in memory.
+type Directory interface {
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Add(req *ldap.AddRequest) error
+	Modify(req *ldap.ModifyRequest) error
+	ModifyDN(req *ldap.ModifyDNRequest) error
+	Del(req *ldap.DelRequest) error
+}
+
+var (
+	_ Directory = &Pool{}
+	_ Directory = &MemoryDirectory{}
+)
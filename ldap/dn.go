@@ -0,0 +1,157 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// Default DN layout, used when the server doesn't set one
+const (
+	DefaultUserDNTemplate  = "uid={{.Name}},{{.OU}},{{.BaseDN}}"
+	DefaultGroupDNTemplate = "cn={{.Name}},{{.OU}},{{.BaseDN}}"
+	DefaultUserOU          = "ou=People"
+	DefaultGroupOU         = "ou=Groups"
+)
+
+// DNValues are the fields a DN template can use. Name is escaped, OU and
+// BaseDN are DNs themselves and are used as they are.
+type DNValues struct {
+	Name   string
+	OU     string
+	BaseDN string
+}
+
+// RenderDN fills in a DN template and checks the result is a valid DN
+func RenderDN(text string, values DNValues) (string, error) {
+	tmpl, err := template.New("dn").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid DN template %q: %s", text, err)
+	}
+	values.Name = escapeDNValue(values.Name)
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return "", fmt.Errorf("invalid DN template %q: %s", text, err)
+	}
+	dn := buf.String()
+	if _, err := ldap.ParseDN(dn); err != nil {
+		return "", fmt.Errorf("invalid DN %q: %s", dn, err)
+	}
+	return dn, nil
+}
+
+// sameDN compares two DNs ignoring spacing and case. The naming attributes
+// used for accounts (uid, cn, ou, dc) all match case insensitively.
+func sameDN(a string, b string) bool {
+	x, err := ldap.ParseDN(a)
+	if err != nil {
+		return strings.EqualFold(a, b)
+	}
+	y, err := ldap.ParseDN(b)
+	if err != nil {
+		return strings.EqualFold(a, b)
+	}
+	if len(x.RDNs) != len(y.RDNs) {
+		return false
+	}
+	for i := range x.RDNs {
+		if !sameRDN(x.RDNs[i], y.RDNs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameRDN(a *ldap.RelativeDN, b *ldap.RelativeDN) bool {
+	if len(a.Attributes) != len(b.Attributes) {
+		return false
+	}
+	for _, x := range a.Attributes {
+		found := false
+		for _, y := range b.Attributes {
+			if strings.EqualFold(x.Type, y.Type) && strings.EqualFold(x.Value, y.Value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// splitDN returns the first RDN of dn and its parent
+func splitDN(dn string) (string, string) {
+	escaped := false
+	for i, c := range dn {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			return dn[:i], dn[i+1:]
+		}
+	}
+	return dn, ""
+}
+
+// ouOf returns the part of dn between its RDN and baseDN, or "" when dn is
+// not below baseDN
+func ouOf(dn string, baseDN string) string {
+	_, parent := splitDN(dn)
+	n := countRDNs(parent) - countRDNs(baseDN)
+	if n <= 0 {
+		return ""
+	}
+	rest := parent
+	for i := 0; i < n; i++ {
+		_, rest = splitDN(rest)
+	}
+	if !sameDN(rest, baseDN) {
+		return ""
+	}
+	return relativeDN(parent, n)
+}
+
+// escapeDNValue escapes an attribute value for use in a DN, see RFC 4514
+func escapeDNValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"' || c == '+' || c == ',' || c == ';' || c == '<' || c == '>' || c == '\\' || c == '=':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '#' && i == 0, c == ' ' && (i == 0 || i == len(value)-1):
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
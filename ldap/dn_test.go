@@ -0,0 +1,89 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"testing"
+)
+
+func TestRenderDN(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		values   DNValues
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "default",
+			template: DefaultUserDNTemplate,
+			values:   DNValues{Name: "user01", OU: DefaultUserOU, BaseDN: "dc=digitalis,dc=io"},
+			want:     "uid=user01,ou=People,dc=digitalis,dc=io",
+		},
+		{
+			name:     "nested ou",
+			template: "cn={{.Name}},{{.OU}},{{.BaseDN}}",
+			values:   DNValues{Name: "user01", OU: "ou=users,ou=accounts", BaseDN: "dc=digitalis,dc=io"},
+			want:     "cn=user01,ou=users,ou=accounts,dc=digitalis,dc=io",
+		},
+		{
+			name:     "escaped name",
+			template: DefaultGroupDNTemplate,
+			values:   DNValues{Name: "ops, team", OU: DefaultGroupOU, BaseDN: "dc=digitalis,dc=io"},
+			want:     `cn=ops\, team,ou=Groups,dc=digitalis,dc=io`,
+		},
+		{
+			name:     "unknown field",
+			template: "uid={{.Username}},{{.BaseDN}}",
+			values:   DNValues{Name: "user01", BaseDN: "dc=digitalis,dc=io"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid dn",
+			template: "{{.Name}},{{.BaseDN}}",
+			values:   DNValues{Name: "user01", BaseDN: "dc=digitalis,dc=io"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderDN(tt.template, tt.values)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderDN() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitDN(t *testing.T) {
+	rdn, parent := splitDN(`cn=ops\, team,ou=Groups,dc=digitalis,dc=io`)
+	if rdn != `cn=ops\, team` || parent != "ou=Groups,dc=digitalis,dc=io" {
+		t.Errorf("splitDN() = %q, %q", rdn, parent)
+	}
+	if !sameDN("UID=user01, ou=People,dc=digitalis,dc=io", "uid=user01,ou=people,dc=digitalis,dc=io") {
+		t.Error("sameDN() should ignore case and spacing")
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// BindError is returned when a new connection can't bind to the server
+type BindError struct {
+	Err error
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("Failed to bind. %s", e.Err)
+}
+
+// Unwrap returns the error from the server
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// IsBindError tells whether err comes from a failed bind
+func IsBindError(err error) bool {
+	var bindErr *BindError
+	return errors.As(err, &bindErr)
+}
+
+// schemaViolations are the result codes of entries the schema doesn't allow
+var schemaViolations = map[uint16]bool{
+	ldap.LDAPResultUndefinedAttributeType:    true,
+	ldap.LDAPResultConstraintViolation:       true,
+	ldap.LDAPResultInvalidAttributeSyntax:    true,
+	ldap.LDAPResultNamingViolation:           true,
+	ldap.LDAPResultObjectClassViolation:      true,
+	ldap.LDAPResultNotAllowedOnRDN:           true,
+	ldap.LDAPResultObjectClassModsProhibited: true,
+}
+
+// IsSchemaViolation tells whether the server refused a write because the
+// entry doesn't fit its schema
+func IsSchemaViolation(err error) bool {
+	var ldapErr *ldap.Error
+	return errors.As(err, &ldapErr) && schemaViolations[ldapErr.ResultCode]
+}
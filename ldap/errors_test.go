@@ -0,0 +1,40 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestErrorKinds(t *testing.T) {
+	bind := fmt.Errorf("Failed to search users. %w", &BindError{Err: ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("bad"))})
+	if !IsBindError(bind) || IsSchemaViolation(bind) {
+		t.Errorf("%v not reported as a bind error", bind)
+	}
+	schema := ldap.NewError(ldap.LDAPResultObjectClassViolation, errors.New("no structural class"))
+	if IsBindError(schema) || !IsSchemaViolation(schema) {
+		t.Errorf("%v not reported as a schema violation", schema)
+	}
+	exists := ldap.NewError(ldap.LDAPResultEntryAlreadyExists, errors.New("exists"))
+	if IsBindError(exists) || IsSchemaViolation(exists) {
+		t.Errorf("%v reported as a bind error or schema violation", exists)
+	}
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import "time"
+
+// AgeIdleConns makes the idle connections of p look older by d, so that tests
+// can reach the health check without waiting for it
+func AgeIdleConns(p *Pool, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.idle {
+		p.idle[i].since = p.idle[i].since.Add(-d)
+	}
+}
+
+// HealthCheckAfter is exported for the tests of the pool
+const HealthCheckAfter = healthCheckAfter
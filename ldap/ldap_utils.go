@@ -18,245 +18,469 @@ package ldap
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	ldapv1 "ldap-accounts-controller/api/v1"
 
 	ldap "github.com/go-ldap/ldap/v3"
 )
 
-var (
-	ldapBaseDN string = getEnv("LDAP_BASE_DN", "dc=digitalis,dc=io")
-)
+// Config holds the settings needed to reach and bind to a LDAP server
+type Config struct {
+	Hostname     string
+	Port         int
+	BaseDN       string
+	BindDN       string
+	BindPassword string
+
+	// TLS dials LDAPS, or upgrades a plain connection when StartTLS is set
+	TLS         bool
+	StartTLS    bool
+	TLSInsecure bool
+	// TLSCA is a PEM bundle used instead of the system roots to verify the
+	// server certificate
+	TLSCA   []byte
+	TLSCert []byte
+	TLSKey  []byte
+
+	// PasswordScheme hashes userPassword, see HashPassword
+	PasswordScheme string
+
+	// DN templates and default OUs for new entries, see RenderDN
+	UserDNTemplate  string
+	GroupDNTemplate string
+	UserOU          string
+	GroupOU         string
+
+	// GroupSchema is used for groups that don't set their own
+	GroupSchema ldapv1.GroupSchema
+	// DeletionPolicy is used for users and groups that don't set their own
+	DeletionPolicy ldapv1.DeletionPolicy
+}
 
-func getEnv(key string, def string) string {
-	val, ok := os.LookupEnv(key)
-	if !ok {
-		fmt.Printf("%s not set\n", key)
-		return def
+// Client runs the account operations against a Directory, normally a pool of
+// connections to the server described by its Config
+type Client struct {
+	config Config
+	dir    Directory
+}
+
+// NewClient returns a Client for the given server settings which keeps at
+// most poolSize connections open
+func NewClient(config Config, poolSize int) *Client {
+	return &Client{
+		config: config,
+		dir:    NewPool(config, poolSize),
 	}
-	return val
 }
 
-// Connect connects to a LDAP server
-func Connect() (*ldap.Conn, error) {
-	ldapHostname := getEnv("LDAP_HOSTNAME", "localhost")
-	ldapPort := getEnv("LDAP_PORT", "389")
-	ldapBind := getEnv("LDAP_BIND", "cn=admin")
-	ldapPassword := getEnv("LDAP_PASSWORD", "letmein")
-	ldapTLS := getEnv("LDAP_TLS", "false")
-	ldapTLSCa := getEnv("LDAP_TLS_CA", "")
-	ldapTLSCert := getEnv("LDAP_TLS_CERT", "")
-	ldapTLSKey := getEnv("LDAP_TLS_KEY", "")
-	ldapTLSInsecure := getEnv("LDAP_TLS_INSECURE", "false")
+// NewDirectoryClient returns a Client running its operations against dir
+// instead of connecting to the server. Only the directory layout and
+// password settings of config are used.
+func NewDirectoryClient(config Config, dir Directory) *Client {
+	return &Client{
+		config: config,
+		dir:    dir,
+	}
+}
+
+// Close releases the pooled connections
+func (c *Client) Close() {
+	if pool, ok := c.dir.(*Pool); ok {
+		pool.Close()
+	}
+}
+
+// Connect opens and binds a new connection to a LDAP server
+func Connect(cfg Config) (*ldap.Conn, error) {
+	port := cfg.Port
+	if port == 0 {
+		port = 389
+		if cfg.TLS && !cfg.StartTLS {
+			port = 636
+		}
+	}
+	addr := fmt.Sprintf("%s:%d", cfg.Hostname, port)
 
 	var conn *ldap.Conn
 	var err error
-	if ldapTLS == "true" {
-		insecureTLS, err := strconv.ParseBool(ldapTLSInsecure)
-		if err != nil {
+	if cfg.TLS {
+		var tlsConfig *tls.Config
+		if tlsConfig, err = newTLSConfig(cfg); err != nil {
 			return nil, err
 		}
-		tlsConfig := tls.Config{
-			InsecureSkipVerify: insecureTLS,
-			ServerName:         ldapHostname,
-			// RootCAs:    rootCA,
-		}
 
-		if ldapTLSCert != "" && ldapTLSKey != "" {
-			ldapTLSCertData, err := ioutil.ReadFile(ldapTLSCert)
-			if err != nil {
+		if cfg.StartTLS {
+			if conn, err = ldap.Dial("tcp", addr); err != nil {
 				return nil, err
 			}
-			ldapTLSKeyData, err := ioutil.ReadFile(ldapTLSKey)
-			if err != nil {
-				return nil, err
+			if err := conn.StartTLS(tlsConfig); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("Failed to start TLS. %s", err)
 			}
-
-			cert, err := tls.X509KeyPair(ldapTLSCertData, ldapTLSKeyData)
-			if err != nil {
-				return nil, err
-			}
-			tlsConfig.Certificates = []tls.Certificate{cert}
-		}
-		if ldapTLSCa != "" {
-			// TODO
+		} else {
+			conn, err = ldap.DialTLS("tcp", addr, tlsConfig)
 		}
-
-		conn, err = ldap.DialTLS("tcp", fmt.Sprintf("%s:%s", ldapHostname, ldapPort), &tlsConfig)
 	} else {
-		conn, err = ldap.Dial("tcp", fmt.Sprintf("%s:%s", ldapHostname, ldapPort))
+		conn, err = ldap.Dial("tcp", addr)
 	}
 	//conn.Debug = true
 	if err != nil {
 		return nil, err
 	}
-	if err := conn.Bind(ldapBind, ldapPassword); err != nil {
-		return nil, fmt.Errorf("Failed to bind. %s", err)
+	start := time.Now()
+	err = conn.Bind(cfg.BindDN, cfg.BindPassword)
+	observe(opBind, start, err)
+	if err != nil {
+		conn.Close()
+		return nil, &BindError{Err: err}
 	}
 
 	return conn, nil
 }
 
-// Get find a user from ldap server
-func GetUser(value string) (ldapv1.LdapUserSpec, error) {
-	conn, err := Connect()
-	if err != nil {
-		return ldapv1.LdapUserSpec{}, fmt.Errorf("Could not connect to ldap server %s", err)
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.TLSInsecure,
+		ServerName:         cfg.Hostname,
 	}
-	// conn.Debug = true
+
+	if len(cfg.TLSCert) != 0 && len(cfg.TLSKey) != 0 {
+		cert, err := tls.X509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if len(cfg.TLSCA) != 0 {
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(cfg.TLSCA) {
+			return nil, fmt.Errorf("no certificates found in the CA bundle")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	return tlsConfig, nil
+}
+
+var (
+	userObjectClasses = []string{"top", "posixAccount", "shadowAccount", "account"}
+	// sshKeyObjectClass comes from the openssh-lpk schema, it is only added
+	// to users with keys so that servers without the schema still work
+	sshKeyObjectClass  = "ldapPublicKey"
+	groupObjectClasses = map[ldapv1.GroupSchemaMode][]string{
+		ldapv1.GroupSchemaRFC2307:            {"posixGroup"},
+		ldapv1.GroupSchemaGroupOfNames:       {"groupOfNames", "posixGroup"},
+		ldapv1.GroupSchemaGroupOfUniqueNames: {"groupOfUniqueNames", "posixGroup"},
+	}
+)
+
+// findEntry returns the first entry under the base DN matching filter, or nil
+// when there is none
+func (c *Client) findEntry(filter string, attributes []string) (*ldap.Entry, error) {
+	entries, err := c.findEntries(filter, attributes)
+	if err != nil || len(entries) < 1 {
+		return nil, err
+	}
+	return entries[0], nil
+}
+
+// findEntries returns the entries under the base DN matching filter
+func (c *Client) findEntries(filter string, attributes []string) ([]*ldap.Entry, error) {
 	search := ldap.NewSearchRequest(
-		ldapBaseDN,
+		c.config.BaseDN,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
-		fmt.Sprintf("(uid=%s)", value),
-		[]string{"uid", "cn", "gidNumber", "uidNumber", "homeDirectory", "loginShell"},
+		filter,
+		attributes,
 		nil)
 
-	result, err := conn.Search(search)
+	result, err := c.dir.Search(search)
+	if err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
 
+// userEntry looks up a user, reading the extra attributes along with the
+// ones the controller writes
+func (c *Client) userEntry(username string, extra ...string) (*ldap.Entry, error) {
+	entry, err := c.findEntry(
+		fmt.Sprintf("(uid=%s)", ldap.EscapeFilter(username)),
+		append([]string{"objectClass", "uid", "cn", "gidNumber", "uidNumber", "homeDirectory", "gecos", "loginShell", "userPassword",
+			"shadowExpire", "shadowMax", "shadowMin", "shadowWarning", "shadowInactive", "sshPublicKey"}, extra...))
 	if err != nil {
-		return ldapv1.LdapUserSpec{}, fmt.Errorf("Failed to search users. %s", err)
+		return nil, fmt.Errorf("Failed to search users. %w", err)
 	}
+	return entry, nil
+}
 
-	// not found
-	if len(result.Entries) < 1 {
-		return ldapv1.LdapUserSpec{}, nil
+// groupEntry looks up a group, reading the extra attributes along with the
+// ones the controller writes
+func (c *Client) groupEntry(name string, extra ...string) (*ldap.Entry, error) {
+	entry, err := c.findEntry(
+		fmt.Sprintf("(&(objectclass=posixGroup)(cn=%s))", ldap.EscapeFilter(name)),
+		append([]string{"objectClass", "cn", "gidNumber", "memberUid", "member", "uniqueMember"}, extra...))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to search groups. %w", err)
 	}
+	return entry, nil
+}
 
-	var userAccount = ldapv1.LdapUserSpec{
-		Username: result.Entries[0].GetAttributeValue("uid"),
-		GID:      result.Entries[0].GetAttributeValue("uidNumber"),
-		UID:      result.Entries[0].GetAttributeValue("gidNumber"),
-		Shell:    result.Entries[0].GetAttributeValue("loginShell"),
-		Homedir:  result.Entries[0].GetAttributeValue("homeDirectory"),
+// userDN returns the DN a user entry should have
+func (c *Client) userDN(user ldapv1.LdapUserSpec) (string, error) {
+	return RenderDN(
+		firstNonEmpty(c.config.UserDNTemplate, DefaultUserDNTemplate),
+		DNValues{
+			Name:   user.Username,
+			OU:     firstNonEmpty(user.OU, c.config.UserOU, DefaultUserOU),
+			BaseDN: c.config.BaseDN,
+		})
+}
+
+// groupDN returns the DN a group entry should have
+func (c *Client) groupDN(group ldapv1.LdapGroupSpec) (string, error) {
+	return RenderDN(
+		firstNonEmpty(c.config.GroupDNTemplate, DefaultGroupDNTemplate),
+		DNValues{
+			Name:   group.Name,
+			OU:     firstNonEmpty(group.OU, c.config.GroupOU, DefaultGroupOU),
+			BaseDN: c.config.BaseDN,
+		})
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
 	}
-	return userAccount, nil
+	return ""
+}
 
+// moveEntry renames entry to dn when the layout has changed. The old RDN
+// value is kept, the attributes are fixed up by the modify that follows.
+func (c *Client) moveEntry(entry *ldap.Entry, dn string) error {
+	if sameDN(entry.DN, dn) {
+		return nil
+	}
+	rdn, parent := splitDN(dn)
+	if err := c.dir.ModifyDN(ldap.NewModifyDNRequest(entry.DN, rdn, false, parent)); err != nil {
+		return fmt.Errorf("Failed to move %s to %s. %w", entry.DN, dn, err)
+	}
+	entry.DN = dn
+	return nil
 }
 
-// Get find a group from ldap server
-func GetGroup(value string) (ldapv1.LdapGroupSpec, error) {
-	conn, err := Connect()
+// userAttributes returns the attributes the controller manages on a user
+// entry, apart from userPassword. cn stays the username as user DNs may be
+// named by it.
+func userAttributes(user ldapv1.LdapUserSpec) (map[string][]string, error) {
+	gecos := firstNonEmpty(user.Gecos, user.Username)
+	expire, err := shadowDays(user.ExpiresOn)
 	if err != nil {
-		return ldapv1.LdapGroupSpec{}, fmt.Errorf("Could not connect to ldap server %s", err)
+		return nil, err
 	}
-	// conn.Debug = true
-	search := ldap.NewSearchRequest(
-		ldapBaseDN,
-		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
-		fmt.Sprintf("(&(objectclass=posixGroup)(cn=%s))", value),
-		[]string{},
-		nil)
+	attrs := map[string][]string{
+		"uid":            attrValues(user.Username),
+		"cn":             attrValues(user.Username),
+		"uidNumber":      attrValues(user.UID),
+		"gidNumber":      attrValues(user.GID),
+		"homeDirectory":  attrValues(user.Homedir),
+		"gecos":          attrValues(gecos),
+		"loginShell":     attrValues(user.Shell),
+		"shadowExpire":   attrValues(expire),
+		"shadowMax":      attrValues(formatDays(user.PasswordMaxAge)),
+		"shadowMin":      attrValues(formatDays(user.PasswordMinAge)),
+		"shadowWarning":  attrValues(formatDays(user.PasswordWarningDays)),
+		"shadowInactive": attrValues(formatDays(user.PasswordInactiveDays)),
+		"sshPublicKey":   attrValues(user.SSHPublicKeys...),
+	}
+	addExtraAttributes(attrs, user.Attributes, ldapv1.IsReservedUserAttribute)
+	return attrs, nil
+}
+
+// userObjectClassesOf returns the objectClasses a user entry needs
+func userObjectClassesOf(user ldapv1.LdapUserSpec) []string {
+	objectClasses := userObjectClasses
+	if len(user.SSHPublicKeys) != 0 {
+		objectClasses = withExtraObjectClasses(objectClasses, []string{sshKeyObjectClass})
+	}
+	return withExtraObjectClasses(objectClasses, user.ExtraObjectClasses)
+}
 
-	result, err := conn.Search(search)
+// Get find a user from ldap server
+func (c *Client) GetUser(value string) (ldapv1.LdapUserSpec, error) {
+	entry, err := c.userEntry(value)
+	if err != nil || entry == nil {
+		return ldapv1.LdapUserSpec{}, err
+	}
 
-	if err != nil {
-		return ldapv1.LdapGroupSpec{}, fmt.Errorf("Failed to search users. %s", err)
+	var userAccount = ldapv1.LdapUserSpec{
+		Username: entry.GetAttributeValue("uid"),
+		UID:      entry.GetAttributeValue("uidNumber"),
+		GID:      entry.GetAttributeValue("gidNumber"),
+		Shell:    entry.GetAttributeValue("loginShell"),
+		Homedir:  entry.GetAttributeValue("homeDirectory"),
+		Gecos:    entry.GetAttributeValue("gecos"),
 	}
+	return userAccount, nil
+}
 
-	// not found
-	if len(result.Entries) < 1 {
-		return ldapv1.LdapGroupSpec{}, nil
+// Get find a group from ldap server
+func (c *Client) GetGroup(value string) (ldapv1.LdapGroupSpec, error) {
+	entry, err := c.groupEntry(value)
+	if err != nil || entry == nil {
+		return ldapv1.LdapGroupSpec{}, err
 	}
 
 	var group = ldapv1.LdapGroupSpec{
-		Name:    result.Entries[0].GetAttributeValue("cn"),
-		GID:     result.Entries[0].GetAttributeValue("uidNumber"),
-		Members: result.Entries[0].GetAttributeValues("memberUid"),
+		Name:    entry.GetAttributeValue("cn"),
+		GID:     entry.GetAttributeValue("gidNumber"),
+		Members: entry.GetAttributeValues("memberUid"),
 	}
 	return group, nil
-
 }
 
-func DeleteUser(user ldapv1.LdapUserSpec) error {
+func (c *Client) DeleteUser(user ldapv1.LdapUserSpec) error {
 	if user.Username == "" {
 		return nil
 	}
+	entry, err := c.userEntry(user.Username)
+	if err != nil {
+		return err
+	}
 	// not found, ignore
-	x, err := GetUser(user.Username)
-	if x.Username == "" {
+	if entry == nil {
 		return nil
 	}
 
-	conn, err := Connect()
-	if err != nil {
-		return fmt.Errorf("Could not connect to ldap server %s", err)
-	}
+	return c.dir.Del(ldap.NewDelRequest(entry.DN, []ldap.Control{}))
+}
 
-	dn := fmt.Sprintf("uid=%s,ou=People,%s", user.Username, ldapBaseDN)
-	delReq := ldap.NewDelRequest(dn, []ldap.Control{})
-	if err := conn.Del(delReq); err != nil {
+func (c *Client) DeleteGroup(group ldapv1.LdapGroupSpec) error {
+	entry, err := c.groupEntry(group.Name)
+	if err != nil {
 		return err
 	}
-
-	return nil
-}
-
-func DeleteGroup(group ldapv1.LdapGroupSpec) error {
 	// not found, ignore
-	x, err := GetGroup(group.Name)
-	if x.Name == "" {
+	if entry == nil {
 		return nil
 	}
 
-	conn, err := Connect()
+	return c.dir.Del(ldap.NewDelRequest(entry.DN, []ldap.Control{}))
+}
+
+// EntryChange stands for the whole entry in the changes returned by AddUser
+// and AddGroup, when it was created
+const EntryChange = "entry"
+
+// AddUser creates the user entry, or updates it in place when it exists, and
+// returns its DN along with what changed: EntryChange when it was created,
+// otherwise the attributes modified and "dn" when it was moved
+func (c *Client) AddUser(user ldapv1.LdapUserSpec) (string, []string, error) {
+	dn, err := c.userDN(user)
 	if err != nil {
-		return fmt.Errorf("Could not connect to ldap server %s", err)
+		return "", nil, err
+	}
+	entry, err := c.userEntry(user.Username, sortedKeys(user.Attributes)...)
+	if err != nil {
+		return "", nil, err
+	}
+	if entry != nil {
+		modReq, err := c.userModifyRequest(entry, user)
+		if err != nil {
+			return entry.DN, nil, err
+		}
+		changes, err := c.updateEntry(entry, dn, modReq)
+		return entry.DN, changes, err
 	}
 
-	dn := fmt.Sprintf("cn=%s,ou=Groups,%s", group.Name, ldapBaseDN)
-	delReq := ldap.NewDelRequest(dn, []ldap.Control{})
-	if err := conn.Del(delReq); err != nil {
-		return err
+	password, err := HashPassword(user.Password, c.config.PasswordScheme)
+	if err != nil {
+		return "", nil, err
 	}
+	attrs, err := userAttributes(user)
+	if err != nil {
+		return "", nil, err
+	}
+	attrs["userPassword"] = attrValues(password)
 
-	return nil
+	if err := c.dir.Add(newAddRequest(dn, userObjectClassesOf(user), attrs)); err != nil {
+		return dn, nil, err
+	}
+	return dn, []string{EntryChange}, nil
 }
 
-// func ModifyUser(user ldapv1.LdapUserSpec) error {
-// 	dn := fmt.Sprintf("uid=%s,ou=People,%s", user.Username, ldapBaseDN)
-// 	modifyRequest := ldap.NewModifyRequest(dn)
-
-// 	return nil
-// }
+// updateEntry moves entry to dn and applies modReq, built for the entry
+// where it was, returning the changes as UserDrift and GroupDrift list them
+func (c *Client) updateEntry(entry *ldap.Entry, dn string, modReq *ldap.ModifyRequest) ([]string, error) {
+	changes := entryDrift(entry, dn, modReq)
+	if err := c.moveEntry(entry, dn); err != nil {
+		return nil, err
+	}
+	modReq.DN = entry.DN
+	if err := c.modifyEntry(modReq); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
 
-func AddUser(user ldapv1.LdapUserSpec) error {
-	conn, err := Connect()
+func (c *Client) userModifyRequest(entry *ldap.Entry, user ldapv1.LdapUserSpec) (*ldap.ModifyRequest, error) {
+	attrs, err := userAttributes(user)
 	if err != nil {
-		return fmt.Errorf("Could not connect to ldap server %s", err)
+		return nil, err
 	}
-	x, err := GetUser(user.Username)
-	if x.Username != "" {
-		// return LdapModifyUser(user)
-		err := DeleteUser(user)
+	modReq := newModifyRequest(entry, userObjectClassesOf(user), attrs)
+
+	// the stored value is salted, so compare it rather than rewriting it
+	if user.Password != "" && !passwordMatches(user.Password, entry.GetEqualFoldAttributeValues("userPassword")) {
+		password, err := HashPassword(user.Password, c.config.PasswordScheme)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		modReq.Replace("userPassword", []string{password})
 	}
+	return modReq, nil
+}
 
-	dn := fmt.Sprintf("uid=%s,ou=People,%s", user.Username, ldapBaseDN)
-	addReq := ldap.NewAddRequest(dn, []ldap.Control{})
-
-	addReq.Attribute("objectClass",
-		[]string{"top", "posixAccount", "shadowAccount", "account"})
-
-	addReq.Attribute("uid", []string{user.Username})
-	addReq.Attribute("cn", []string{user.Username})
-	addReq.Attribute("uidNumber", []string{user.UID})
-	addReq.Attribute("gidNumber", []string{user.GID})
-	addReq.Attribute("homeDirectory", []string{user.Homedir})
-	addReq.Attribute("gecos", []string{user.Username})
-	addReq.Attribute("userPassword", []string{user.Password})
-	addReq.Attribute("loginShell", []string{user.Shell})
+// UserDrift compares the live user entry with the spec and returns the
+// attributes that differ, "dn" when it has moved, and whether the entry
+// exists at all
+func (c *Client) UserDrift(user ldapv1.LdapUserSpec) ([]string, bool, error) {
+	entry, err := c.userEntry(user.Username, sortedKeys(user.Attributes)...)
+	if err != nil || entry == nil {
+		return nil, false, err
+	}
+	dn, err := c.userDN(user)
+	if err != nil {
+		return nil, true, err
+	}
+	modReq, err := c.userModifyRequest(entry, user)
+	if err != nil {
+		return nil, true, err
+	}
+	return entryDrift(entry, dn, modReq), true, nil
+}
 
-	if err := conn.Add(addReq); err != nil {
-		return err
+func entryDrift(entry *ldap.Entry, dn string, modReq *ldap.ModifyRequest) []string {
+	var drift []string
+	if !sameDN(entry.DN, dn) {
+		drift = append(drift, "dn")
 	}
+	return append(drift, changedAttributes(modReq)...)
+}
 
-	return nil
+func passwordMatches(password string, values []string) bool {
+	for _, v := range values {
+		if CheckPassword(password, v) {
+			return true
+		}
+	}
+	return false
 }
 
 func isNumber(v string) bool {
@@ -266,56 +490,324 @@ func isNumber(v string) bool {
 	return false
 }
 
-// ldapGroupMembers builds a list for memberUid
-func ldapGroupMembers(group ldapv1.LdapGroupSpec) ([]string, error) {
-	var members []string
+// groupMember is a group member as found in LDAP
+type groupMember struct {
+	uid       string
+	uidNumber string
+	dn        string
+}
 
-	for m := range group.Members {
-		if isNumber(group.Members[m]) {
-			members = append(members, group.Members[m])
-		} else {
-			x, err := GetUser(group.Members[m])
-			if err != nil {
-				return members, err
+// memberSearchBatch is how many members are looked up by a single search,
+// keeping the filter and the number of entries returned reasonable
+const memberSearchBatch = 100
+
+// ldapGroupMembers looks the members up in LDAP. Usernames that are not found
+// and disabled accounts are left out, numbers without an account are kept for
+// memberUid only.
+func (c *Client) ldapGroupMembers(group ldapv1.LdapGroupSpec) ([]groupMember, error) {
+	var entries []*ldap.Entry
+	for start := 0; start < len(group.Members); start += memberSearchBatch {
+		end := start + memberSearchBatch
+		if end > len(group.Members) {
+			end = len(group.Members)
+		}
+		var filter strings.Builder
+		filter.WriteString("(|")
+		for _, member := range group.Members[start:end] {
+			if isNumber(member) {
+				fmt.Fprintf(&filter, "(&(objectClass=posixAccount)(uidNumber=%s))", ldap.EscapeFilter(member))
+			} else {
+				fmt.Fprintf(&filter, "(uid=%s)", ldap.EscapeFilter(member))
+			}
+		}
+		filter.WriteString(")")
+		found, err := c.findEntries(filter.String(), []string{"objectClass", "uid", "uidNumber", "shadowExpire"})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to search group members. %w", err)
+		}
+		entries = append(entries, found...)
+	}
+
+	var members []groupMember
+	for _, member := range group.Members {
+		entry := memberEntry(entries, member)
+		if entry == nil {
+			if isNumber(member) {
+				members = append(members, groupMember{uidNumber: member})
 			}
-			members = append(members, x.UID)
+			continue
+		}
+		if !isDisabled(entry) {
+			members = append(members, groupMember{
+				uid:       entry.GetAttributeValue("uid"),
+				uidNumber: entry.GetAttributeValue("uidNumber"),
+				dn:        entry.DN,
+			})
 		}
 	}
 	return members, nil
 }
 
-func AddGroup(group ldapv1.LdapGroupSpec) error {
-	conn, err := Connect()
+// memberEntry returns the first of the entries matching a member, by uid
+// number for numbers and by username otherwise
+func memberEntry(entries []*ldap.Entry, member string) *ldap.Entry {
+	for _, entry := range entries {
+		if isNumber(member) {
+			if entry.GetAttributeValue("uidNumber") == member && containsFold(entry.GetAttributeValues("objectClass"), "posixAccount") {
+				return entry
+			}
+		} else if containsFold(entry.GetAttributeValues("uid"), member) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// groupSchema returns the group's schema, or the server's
+func (c *Client) groupSchema(group ldapv1.LdapGroupSpec) ldapv1.GroupSchema {
+	schema := c.config.GroupSchema
+	if group.Schema != nil {
+		schema = *group.Schema
+	}
+	if schema.Mode == "" {
+		schema.Mode = ldapv1.GroupSchemaRFC2307
+	}
+	return schema
+}
+
+// memberValues returns what memberUid, when used, and member or uniqueMember
+// list for the members
+func memberValues(schema ldapv1.GroupSchema, members []groupMember) ([]string, []string) {
+	var uids, dns []string
+	for _, m := range members {
+		if schema.MemberUIDFormat != ldapv1.MemberUIDNumber && m.uid != "" {
+			uids = append(uids, m.uid)
+		} else {
+			uids = append(uids, m.uidNumber)
+		}
+		if m.dn != "" {
+			dns = append(dns, m.dn)
+		}
+	}
+	if schema.Mode != ldapv1.GroupSchemaRFC2307 && !schema.MemberUID {
+		uids = nil
+	}
+	return uids, dns
+}
+
+// groupAttributes returns the objectClasses and attributes of the group entry
+// at dn. In the DN modes a group without members lists itself, as member and
+// uniqueMember are required.
+func (c *Client) groupAttributes(group ldapv1.LdapGroupSpec, dn string) ([]string, map[string][]string, error) {
+	schema := c.groupSchema(group)
+	objectClasses, ok := groupObjectClasses[schema.Mode]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown group schema %s", schema.Mode)
+	}
+	members, err := c.ldapGroupMembers(group)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uids, dns := memberValues(schema, members)
+	if len(dns) == 0 {
+		dns = []string{dn}
+	}
+	attrs := map[string][]string{
+		"cn":        attrValues(group.Name),
+		"gidNumber": attrValues(group.GID),
+		"memberUid": attrValues(uids...),
+	}
+	switch schema.Mode {
+	case ldapv1.GroupSchemaGroupOfNames:
+		attrs["member"] = dns
+		attrs["uniqueMember"] = nil
+	case ldapv1.GroupSchemaGroupOfUniqueNames:
+		attrs["uniqueMember"] = dns
+		attrs["member"] = nil
+	default:
+		attrs["member"] = nil
+		attrs["uniqueMember"] = nil
+	}
+	addExtraAttributes(attrs, group.Attributes, ldapv1.IsReservedGroupAttribute)
+	return withExtraObjectClasses(objectClasses, group.ExtraObjectClasses), attrs, nil
+}
+
+// GroupMembers returns the members as they are written to the group, the
+// memberUid values or the member DNs when memberUid is not used, and the
+// usernames that were not found
+func (c *Client) GroupMembers(group ldapv1.LdapGroupSpec) ([]string, []string, error) {
+	members, err := c.ldapGroupMembers(group)
 	if err != nil {
-		return fmt.Errorf("Could not connect to ldap server %s", err)
+		return nil, nil, err
 	}
-	x, err := GetGroup(group.Name)
-	if x.Name != "" {
-		err := DeleteGroup(group)
+
+	var missing []string
+	for _, name := range group.Members {
+		found := isNumber(name)
+		for _, m := range members {
+			if found = found || strings.EqualFold(m.uid, name); found {
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+
+	schema := c.groupSchema(group)
+	uids, dns := memberValues(schema, members)
+	if schema.Mode != ldapv1.GroupSchemaRFC2307 && !schema.MemberUID {
+		return dns, missing, nil
+	}
+	return uids, missing, nil
+}
+
+// AddGroup creates the group entry, or updates it in place when it exists,
+// and returns its DN along with what changed, as AddUser does
+func (c *Client) AddGroup(group ldapv1.LdapGroupSpec) (string, []string, error) {
+	dn, err := c.groupDN(group)
+	if err != nil {
+		return "", nil, err
+	}
+	entry, err := c.groupEntry(group.Name, sortedKeys(group.Attributes)...)
+	if err != nil {
+		return "", nil, err
+	}
+	if entry != nil {
+		modReq, err := c.groupModifyRequest(entry, group, dn)
 		if err != nil {
-			return err
+			return "", nil, err
 		}
+		changes, err := c.updateEntry(entry, dn, modReq)
+		return entry.DN, changes, err
 	}
 
-	dn := fmt.Sprintf("cn=%s,ou=Groups,%s", group.Name, ldapBaseDN)
-	addReq := ldap.NewAddRequest(dn, []ldap.Control{})
+	objectClasses, attrs, err := c.groupAttributes(group, dn)
+	if err != nil {
+		return "", nil, err
+	}
 
-	addReq.Attribute("objectClass",
-		[]string{"posixGroup"})
+	if err := c.dir.Add(newAddRequest(dn, objectClasses, attrs)); err != nil {
+		return dn, nil, err
+	}
+	return dn, []string{EntryChange}, nil
+}
 
-	addReq.Attribute("cn", []string{group.Name})
-	addReq.Attribute("gidNumber", []string{group.GID})
-	membersUids, e := ldapGroupMembers(group)
-	if e != nil {
-		return e
+// GroupDrift compares the live group entry with the spec and returns the
+// attributes that differ, "dn" when it has moved, and whether the entry
+// exists at all
+func (c *Client) GroupDrift(group ldapv1.LdapGroupSpec) ([]string, bool, error) {
+	entry, err := c.groupEntry(group.Name, sortedKeys(group.Attributes)...)
+	if err != nil || entry == nil {
+		return nil, false, err
 	}
-	if len(membersUids) != 0 {
-		addReq.Attribute("memberUid", membersUids)
+	dn, err := c.groupDN(group)
+	if err != nil {
+		return nil, true, err
+	}
+	modReq, err := c.groupModifyRequest(entry, group, dn)
+	if err != nil {
+		return nil, true, err
 	}
+	return entryDrift(entry, dn, modReq), true, nil
+}
 
-	if err := conn.Add(addReq); err != nil {
-		return err
+// groupModifyRequest returns the changes turning entry into the group at dn.
+// The objectClasses of the other schema modes are removed along with their
+// member attributes, so that the group can be switched back and forth.
+func (c *Client) groupModifyRequest(entry *ldap.Entry, group ldapv1.LdapGroupSpec, dn string) (*ldap.ModifyRequest, error) {
+	objectClasses, attrs, err := c.groupAttributes(group, dn)
+	if err != nil {
+		return nil, err
 	}
+	modReq := newModifyRequest(entry, objectClasses, attrs)
 
-	return nil
+	var stale []string
+	for _, oc := range entry.GetEqualFoldAttributeValues("objectClass") {
+		if isGroupSchemaObjectClass(oc) && !containsFold(objectClasses, oc) {
+			stale = append(stale, oc)
+		}
+	}
+	if len(stale) != 0 {
+		modReq.Delete("objectClass", stale)
+	}
+	return modReq, nil
+}
+
+// isGroupSchemaObjectClass tells whether one of the schema modes writes the
+// objectClass.
+func isGroupSchemaObjectClass(objectClass string) bool {
+	for _, objectClasses := range groupObjectClasses {
+		if containsFold(objectClasses, objectClass) {
+			return true
+		}
+	}
+	return false
+}
+
+// UIDNumberOwner returns the DN of an account other than username's that
+// holds uidNumber, or "" when there is none
+func (c *Client) UIDNumberOwner(uidNumber string, username string) (string, error) {
+	return c.otherEntry(fmt.Sprintf("(&(objectClass=posixAccount)(uidNumber=%s)(!(uid=%s)))",
+		ldap.EscapeFilter(uidNumber), ldap.EscapeFilter(username)))
+}
+
+// GIDNumberOwner returns the DN of a group other than name that holds
+// gidNumber, or "" when there is none
+func (c *Client) GIDNumberOwner(gidNumber string, name string) (string, error) {
+	return c.otherEntry(fmt.Sprintf("(&(objectClass=posixGroup)(gidNumber=%s)(!(cn=%s)))",
+		ldap.EscapeFilter(gidNumber), ldap.EscapeFilter(name)))
+}
+
+func (c *Client) otherEntry(filter string) (string, error) {
+	entry, err := c.findEntry(filter, []string{"dn"})
+	if err != nil || entry == nil {
+		return "", err
+	}
+	return entry.DN, nil
+}
+
+// UIDNumbers returns the uidNumber of every posixAccount in the directory
+func (c *Client) UIDNumbers() ([]int64, error) {
+	return c.numbers("(&(objectClass=posixAccount)(uidNumber=*))", "uidNumber")
+}
+
+// GIDNumbers returns the gidNumber of every posixGroup in the directory
+func (c *Client) GIDNumbers() ([]int64, error) {
+	return c.numbers("(&(objectClass=posixGroup)(gidNumber=*))", "gidNumber")
+}
+
+// numbers reads a numeric attribute off every entry matching filter. The
+// RFC2307 schema has no ordering rule for uidNumber and gidNumber, so ranges
+// can't be searched for.
+func (c *Client) numbers(filter string, attribute string) ([]int64, error) {
+	search := ldap.NewSearchRequest(
+		c.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter,
+		[]string{attribute},
+		nil)
+
+	result, err := c.dir.Search(search)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to search %s. %w", attribute, err)
+	}
+	var numbers []int64
+	for _, entry := range result.Entries {
+		for _, v := range entry.GetEqualFoldAttributeValues(attribute) {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				numbers = append(numbers, n)
+			}
+		}
+	}
+	return numbers, nil
+}
+
+// modifyEntry sends the request unless there is nothing to change
+func (c *Client) modifyEntry(modReq *ldap.ModifyRequest) error {
+	if len(modReq.Changes) == 0 {
+		return nil
+	}
+	return c.dir.Modify(modReq)
 }
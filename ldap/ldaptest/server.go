@@ -0,0 +1,463 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ldaptest runs an in-process LDAP server for tests. It speaks
+// enough of the protocol for the controllers: simple bind, StartTLS, search,
+// add, modify, delete and modifyDN, keeping the entries in a
+// ldap.MemoryDirectory.
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	ld "ldap-accounts-controller/ldap"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// Server is a LDAP server listening on 127.0.0.1
+type Server struct {
+	// Dir holds the entries, tests can inspect and seed it directly
+	Dir *ld.MemoryDirectory
+
+	BindDN       string
+	BindPassword string
+
+	// Host and Port the server listens on
+	Host string
+	Port int
+	// TLS is set when the listener uses implicit TLS
+	TLS bool
+	// CA is the PEM certificate the server certificate is signed with
+	CA []byte
+
+	listener net.Listener
+	cert     tls.Certificate
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	binds int
+	wg    sync.WaitGroup
+}
+
+// NewServer starts a plain LDAP server accepting binds with the given
+// credentials. StartTLS is supported, see CA.
+func NewServer(bindDN string, bindPassword string) (*Server, error) {
+	return newServer(bindDN, bindPassword, false)
+}
+
+// NewTLSServer starts a LDAPS server accepting binds with the given
+// credentials
+func NewTLSServer(bindDN string, bindPassword string) (*Server, error) {
+	return newServer(bindDN, bindPassword, true)
+}
+
+func newServer(bindDN string, bindPassword string, implicitTLS bool) (*Server, error) {
+	caPEM, cert, err := newCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	var l net.Listener
+	if implicitTLS {
+		l, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		return nil, err
+	}
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	s := &Server{
+		Dir:          ld.NewMemoryDirectory(),
+		BindDN:       bindDN,
+		BindPassword: bindPassword,
+		Host:         host,
+		Port:         p,
+		TLS:          implicitTLS,
+		CA:           caPEM,
+		listener:     l,
+		cert:         cert,
+		conns:        map[net.Conn]struct{}{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Config returns the settings to connect and bind to the server
+func (s *Server) Config() ld.Config {
+	return ld.Config{
+		Hostname:     s.Host,
+		Port:         s.Port,
+		BindDN:       s.BindDN,
+		BindPassword: s.BindPassword,
+		TLS:          s.TLS,
+		TLSCA:        s.CA,
+	}
+}
+
+// Close stops the listener and drops the open connections
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Binds returns the number of bind requests received so far
+func (s *Server) Binds() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.binds
+}
+
+// DropConnections closes the open connections, as a server restart would,
+// but keeps accepting new ones
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle answers the requests of one connection in order
+func (s *Server) handle(conn net.Conn) {
+	bound := false
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, ok := packet.Children[0].Value.(int64)
+		if !ok {
+			return
+		}
+		req := packet.Children[1]
+
+		switch req.Tag {
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationBindRequest:
+			code, msg := s.bind(req)
+			bound = code == ldap.LDAPResultSuccess
+			if !write(conn, result(id, ldap.ApplicationBindResponse, code, msg)) {
+				return
+			}
+		case ldap.ApplicationExtendedRequest:
+			if len(req.Children) == 0 || req.Children[0].Data.String() != startTLSOID {
+				write(conn, result(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "unsupported extended operation"))
+				continue
+			}
+			if _, ok := conn.(*tls.Conn); ok {
+				write(conn, result(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultOperationsError, "TLS already started"))
+				continue
+			}
+			if !write(conn, result(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess, "")) {
+				return
+			}
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{s.cert}})
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.conns[tlsConn] = struct{}{}
+			s.mu.Unlock()
+			conn = tlsConn
+		case ldap.ApplicationSearchRequest, ldap.ApplicationAddRequest, ldap.ApplicationModifyRequest,
+			ldap.ApplicationDelRequest, ldap.ApplicationModifyDNRequest:
+			responseTag := req.Tag + 1
+			if req.Tag == ldap.ApplicationSearchRequest {
+				responseTag = ldap.ApplicationSearchResultDone
+			}
+			if !bound {
+				if !write(conn, result(id, responseTag, ldap.LDAPResultInsufficientAccessRights, "bind first")) {
+					return
+				}
+				continue
+			}
+			var err error
+			if req.Tag == ldap.ApplicationSearchRequest {
+				err = s.search(conn, id, req)
+			} else {
+				err = s.update(req)
+			}
+			code, msg := resultCode(err)
+			if !write(conn, result(id, responseTag, code, msg)) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func write(conn net.Conn, packet *ber.Packet) bool {
+	_, err := conn.Write(packet.Bytes())
+	return err == nil
+}
+
+func result(id int64, tag ber.Tag, code uint16, msg string) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, msg, "diagnosticMessage"))
+	packet.AppendChild(response)
+	return packet
+}
+
+// resultCode maps an error from the directory to a LDAP result
+func resultCode(err error) (uint16, string) {
+	if err == nil {
+		return ldap.LDAPResultSuccess, ""
+	}
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) {
+		msg := ldapErr.Err.Error()
+		return ldapErr.ResultCode, msg
+	}
+	return ldap.LDAPResultOther, err.Error()
+}
+
+func (s *Server) bind(req *ber.Packet) (uint16, string) {
+	s.mu.Lock()
+	s.binds++
+	s.mu.Unlock()
+	if len(req.Children) < 3 || req.Children[2].Tag != 0 {
+		return ldap.LDAPResultAuthMethodNotSupported, "only simple binds are supported"
+	}
+	name := req.Children[1].Data.String()
+	password := req.Children[2].Data.String()
+	if name != s.BindDN || password != s.BindPassword {
+		return ldap.LDAPResultInvalidCredentials, "invalid credentials"
+	}
+	return ldap.LDAPResultSuccess, ""
+}
+
+// search runs the request and writes an entry message per result, the final
+// done message is left to the caller
+func (s *Server) search(conn net.Conn, id int64, req *ber.Packet) error {
+	if len(req.Children) < 8 {
+		return ldap.NewError(ldap.LDAPResultProtocolError, errors.New("invalid search request"))
+	}
+	filter, err := ldap.DecompileFilter(req.Children[6])
+	if err != nil {
+		return ldap.NewError(ldap.LDAPResultProtocolError, err)
+	}
+	var attributes []string
+	for _, attr := range req.Children[7].Children {
+		attributes = append(attributes, attr.Data.String())
+	}
+	search := ldap.NewSearchRequest(
+		req.Children[0].Data.String(),
+		int(integer(req.Children[1])), ldap.NeverDerefAliases, int(integer(req.Children[3])), 0, false,
+		filter,
+		attributes,
+		nil)
+
+	res, err := s.Dir.Search(search)
+	if err != nil {
+		return err
+	}
+	for _, entry := range res.Entries {
+		packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+		packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+		response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "objectName"))
+		attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+		for _, attr := range entry.Attributes {
+			attrs.AppendChild(encodeAttribute(attr.Name, attr.Values))
+		}
+		response.AppendChild(attrs)
+		packet.AppendChild(response)
+		if !write(conn, packet) {
+			return errors.New("connection closed")
+		}
+	}
+	return nil
+}
+
+// update decodes an add, modify, delete or modifyDN request and applies it
+func (s *Server) update(req *ber.Packet) error {
+	switch req.Tag {
+	case ldap.ApplicationDelRequest:
+		return s.Dir.Del(ldap.NewDelRequest(req.Data.String(), nil))
+	case ldap.ApplicationAddRequest:
+		if len(req.Children) < 2 {
+			break
+		}
+		add := ldap.NewAddRequest(req.Children[0].Data.String(), nil)
+		for _, attr := range req.Children[1].Children {
+			name, values, err := decodeAttribute(attr)
+			if err != nil {
+				return err
+			}
+			add.Attribute(name, values)
+		}
+		return s.Dir.Add(add)
+	case ldap.ApplicationModifyRequest:
+		if len(req.Children) < 2 {
+			break
+		}
+		modify := ldap.NewModifyRequest(req.Children[0].Data.String(), nil)
+		for _, change := range req.Children[1].Children {
+			if len(change.Children) != 2 {
+				return ldap.NewError(ldap.LDAPResultProtocolError, errors.New("invalid change"))
+			}
+			name, values, err := decodeAttribute(change.Children[1])
+			if err != nil {
+				return err
+			}
+			modify.Changes = append(modify.Changes, ldap.Change{
+				Operation:    uint(integer(change.Children[0])),
+				Modification: ldap.PartialAttribute{Type: name, Vals: values},
+			})
+		}
+		return s.Dir.Modify(modify)
+	case ldap.ApplicationModifyDNRequest:
+		if len(req.Children) < 3 {
+			break
+		}
+		deleteOld := len(req.Children[2].Data.Bytes()) != 0 && req.Children[2].Data.Bytes()[0] != 0
+		var newSuperior string
+		if len(req.Children) > 3 {
+			newSuperior = req.Children[3].Data.String()
+		}
+		return s.Dir.ModifyDN(ldap.NewModifyDNRequest(req.Children[0].Data.String(), req.Children[1].Data.String(), deleteOld, newSuperior))
+	}
+	return ldap.NewError(ldap.LDAPResultProtocolError, fmt.Errorf("invalid %s", ldap.ApplicationMap[uint8(req.Tag)]))
+}
+
+func integer(packet *ber.Packet) int64 {
+	v, _ := packet.Value.(int64)
+	return v
+}
+
+func decodeAttribute(packet *ber.Packet) (string, []string, error) {
+	if len(packet.Children) != 2 {
+		return "", nil, ldap.NewError(ldap.LDAPResultProtocolError, errors.New("invalid attribute"))
+	}
+	var values []string
+	for _, v := range packet.Children[1].Children {
+		values = append(values, v.Data.String())
+	}
+	return packet.Children[0].Data.String(), values, nil
+}
+
+func encodeAttribute(name string, values []string) *ber.Packet {
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+	seq.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+	set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "AttributeValue")
+	for _, v := range values {
+		set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Vals"))
+	}
+	seq.AppendChild(set)
+	return seq
+}
+
+// newCertificate returns a self-signed CA as PEM and a certificate for
+// 127.0.0.1 signed by it
+func newCertificate() ([]byte, tls.Certificate, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldaptest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	return caPEM, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldaptest
+
+import (
+	"testing"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+	ld "ldap-accounts-controller/ldap"
+)
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		tls      bool
+		startTLS bool
+	}{
+		{name: "plain"},
+		{name: "ldaps", tls: true},
+		{name: "starttls", startTLS: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newServer := NewServer
+			if tt.tls {
+				newServer = NewTLSServer
+			}
+			s, err := newServer("cn=admin,dc=digitalis,dc=io", "letmein")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			config := s.Config()
+			config.BaseDN = "dc=digitalis,dc=io"
+			if tt.startTLS {
+				config.TLS, config.StartTLS = true, true
+			}
+			c := ld.NewClient(config, 2)
+			defer c.Close()
+
+			user := ldapv1.LdapUserSpec{Username: "user01", UID: "1000", GID: "1000", Password: "secret"}
+			dn, _, err := c.AddUser(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := c.GetUser("user01"); err != nil || got.UID != "1000" {
+				t.Fatalf("GetUser() = %+v, %v", got, err)
+			}
+			if _, _, err := c.AddGroup(ldapv1.LdapGroupSpec{Name: "admins", GID: "2000", Members: []string{"user01"}}); err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Dir.Entry("cn=admins,ou=Groups,dc=digitalis,dc=io").GetAttributeValue("memberUid"); got != "user01" {
+				t.Errorf("memberUid = %s, want user01", got)
+			}
+
+			user.OU = "ou=Staff"
+			user.Shell = "/bin/bash"
+			if dn, _, err = c.AddUser(user); err != nil {
+				t.Fatal(err)
+			}
+			entry := s.Dir.Entry(dn)
+			if dn != "uid=user01,ou=Staff,dc=digitalis,dc=io" || entry == nil || entry.GetAttributeValue("loginShell") != "/bin/bash" {
+				t.Errorf("user not moved and updated, entries %v", s.Dir.DNs())
+			}
+
+			if err := c.DeleteUser(user); err != nil {
+				t.Fatal(err)
+			}
+			if s.Dir.Entry(dn) != nil {
+				t.Error("user not deleted")
+			}
+		})
+	}
+}
+
+func TestServerBind(t *testing.T) {
+	s, err := NewServer("cn=admin,dc=digitalis,dc=io", "letmein")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	config := s.Config()
+	config.BindPassword = "wrong"
+	if conn, err := ld.Connect(config); err == nil {
+		conn.Close()
+		t.Fatal("expected the bind to fail")
+	}
+
+	// a client reports it through every operation
+	c := ld.NewClient(config, 1)
+	defer c.Close()
+	if _, err := c.GetUser("user01"); !ld.IsBindError(err) {
+		t.Errorf("GetUser() = %v, want a bind error", err)
+	}
+}
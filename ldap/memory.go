@@ -0,0 +1,523 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// MemoryDirectory is a Directory keeping its entries in memory, meant for
+// tests. DNs, attribute names and values are compared case insensitively and
+// parent entries don't need to exist.
+type MemoryDirectory struct {
+	mu      sync.RWMutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+// NewMemoryDirectory returns an empty directory
+func NewMemoryDirectory() *MemoryDirectory {
+	return &MemoryDirectory{
+		entries: map[string]*memoryEntry{},
+	}
+}
+
+// normalizeDN returns the form of dn used to key and compare entries
+func normalizeDN(dn string) (string, error) {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return "", ldap.NewError(ldap.LDAPResultInvalidDNSyntax, err)
+	}
+	rdns := make([]string, 0, len(parsed.RDNs))
+	for _, rdn := range parsed.RDNs {
+		var parts []string
+		for _, attr := range rdn.Attributes {
+			parts = append(parts, strings.ToLower(attr.Type)+"="+escapeDNValue(strings.ToLower(attr.Value)))
+		}
+		sort.Strings(parts)
+		rdns = append(rdns, strings.Join(parts, "+"))
+	}
+	return strings.Join(rdns, ","), nil
+}
+
+// under tells whether the normalized dn is base itself or below it, as far
+// as scope allows
+func under(dn string, base string, scope int) bool {
+	if base == "" {
+		switch scope {
+		case ldap.ScopeBaseObject:
+			return dn == ""
+		case ldap.ScopeSingleLevel:
+			_, parent := splitDN(dn)
+			return dn != "" && parent == ""
+		}
+		return true
+	}
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == base
+	case ldap.ScopeSingleLevel:
+		_, parent := splitDN(dn)
+		return parent == base
+	}
+	return dn == base || strings.HasSuffix(dn, ","+base)
+}
+
+func (e *memoryEntry) values(name string) []string {
+	for k, v := range e.attrs {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func (e *memoryEntry) set(name string, values []string) {
+	for k := range e.attrs {
+		if strings.EqualFold(k, name) {
+			delete(e.attrs, k)
+		}
+	}
+	if len(values) != 0 {
+		e.attrs[name] = values
+	}
+}
+
+func (e *memoryEntry) toEntry(attributes []string) *ldap.Entry {
+	attrs := map[string][]string{}
+	all := len(attributes) == 0
+	for _, a := range attributes {
+		if a == "*" {
+			all = true
+		}
+	}
+	for k, v := range e.attrs {
+		if all {
+			attrs[k] = append([]string{}, v...)
+			continue
+		}
+		for _, a := range attributes {
+			if strings.EqualFold(a, k) {
+				attrs[k] = append([]string{}, v...)
+			}
+		}
+	}
+	return ldap.NewEntry(e.dn, attrs)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns the entries below the base DN matching the filter
+func (m *MemoryDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	filter, err := ldap.CompileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	base, err := normalizeDN(req.BaseDN)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []string
+	for key := range m.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := &ldap.SearchResult{}
+	for _, key := range keys {
+		if !under(key, base, req.Scope) {
+			continue
+		}
+		entry := m.entries[key]
+		match, err := matchFilter(entry, filter)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			continue
+		}
+		result.Entries = append(result.Entries, entry.toEntry(req.Attributes))
+		if req.SizeLimit > 0 && len(result.Entries) == req.SizeLimit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// Add creates a new entry
+func (m *MemoryDirectory) Add(req *ldap.AddRequest) error {
+	key, err := normalizeDN(req.DN)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.entries[key]; ok {
+		return ldap.NewError(ldap.LDAPResultEntryAlreadyExists, fmt.Errorf("entry %s already exists", req.DN))
+	}
+	entry := &memoryEntry{dn: req.DN, attrs: map[string][]string{}}
+	for _, attr := range req.Attributes {
+		entry.set(attr.Type, append(entry.values(attr.Type), attr.Vals...))
+	}
+	m.entries[key] = entry
+	return nil
+}
+
+// Modify applies the changes of the request in order. Like a server it
+// fails without changing anything when one of them cannot be applied.
+func (m *MemoryDirectory) Modify(req *ldap.ModifyRequest) error {
+	key, err := normalizeDN(req.DN)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return ldap.NewError(ldap.LDAPResultNoSuchObject, fmt.Errorf("entry %s not found", req.DN))
+	}
+	modified := &memoryEntry{dn: entry.dn, attrs: map[string][]string{}}
+	for k, v := range entry.attrs {
+		modified.attrs[k] = append([]string{}, v...)
+	}
+
+	for _, change := range req.Changes {
+		name := change.Modification.Type
+		vals := change.Modification.Vals
+		current := modified.values(name)
+		switch change.Operation {
+		case ldap.AddAttribute:
+			for _, v := range vals {
+				if containsFold(current, v) {
+					return ldap.NewError(ldap.LDAPResultAttributeOrValueExists, fmt.Errorf("%s already has value %s", name, v))
+				}
+				current = append(current, v)
+			}
+			modified.set(name, current)
+		case ldap.DeleteAttribute:
+			if len(current) == 0 {
+				return ldap.NewError(ldap.LDAPResultNoSuchAttribute, fmt.Errorf("no attribute %s", name))
+			}
+			if len(vals) == 0 {
+				modified.set(name, nil)
+				continue
+			}
+			var kept []string
+			for _, v := range current {
+				if !containsFold(vals, v) {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) != len(current)-len(vals) {
+				return ldap.NewError(ldap.LDAPResultNoSuchAttribute, fmt.Errorf("%s is missing some of the values to delete", name))
+			}
+			modified.set(name, kept)
+		case ldap.ReplaceAttribute:
+			modified.set(name, append([]string{}, vals...))
+		default:
+			return ldap.NewError(ldap.LDAPResultProtocolError, fmt.Errorf("unknown modify operation %d", change.Operation))
+		}
+	}
+	if err := checkRDN(modified); err != nil {
+		return err
+	}
+
+	m.entries[key] = modified
+	return nil
+}
+
+// checkRDN fails like a server does when the values naming the entry have
+// been removed from it
+func checkRDN(entry *memoryEntry) error {
+	parsed, err := ldap.ParseDN(entry.dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return err
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if !containsFold(entry.values(attr.Type), attr.Value) {
+			return ldap.NewError(ldap.LDAPResultNotAllowedOnRDN, fmt.Errorf("%s=%s names entry %s", attr.Type, attr.Value, entry.dn))
+		}
+	}
+	return nil
+}
+
+// ModifyDN renames an entry, moving the entries below it along
+func (m *MemoryDirectory) ModifyDN(req *ldap.ModifyDNRequest) error {
+	key, err := normalizeDN(req.DN)
+	if err != nil {
+		return err
+	}
+	oldRDN, parent := splitDN(req.DN)
+	if req.NewSuperior != "" {
+		parent = req.NewSuperior
+	}
+	newDN := req.NewRDN
+	if parent != "" {
+		newDN += "," + parent
+	}
+	newKey, err := normalizeDN(newDN)
+	if err != nil {
+		return err
+	}
+	newRDN, err := ldap.ParseDN(req.NewRDN)
+	if err != nil || len(newRDN.RDNs) != 1 {
+		return ldap.NewError(ldap.LDAPResultInvalidDNSyntax, fmt.Errorf("invalid RDN %s", req.NewRDN))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return ldap.NewError(ldap.LDAPResultNoSuchObject, fmt.Errorf("entry %s not found", req.DN))
+	}
+	if _, ok := m.entries[newKey]; ok && newKey != key {
+		return ldap.NewError(ldap.LDAPResultEntryAlreadyExists, fmt.Errorf("entry %s already exists", newDN))
+	}
+
+	if req.DeleteOldRDN {
+		if old, err := ldap.ParseDN(oldRDN); err == nil {
+			for _, attr := range old.RDNs[0].Attributes {
+				var kept []string
+				for _, v := range entry.values(attr.Type) {
+					if !strings.EqualFold(v, attr.Value) {
+						kept = append(kept, v)
+					}
+				}
+				entry.set(attr.Type, kept)
+			}
+		}
+	}
+	for _, attr := range newRDN.RDNs[0].Attributes {
+		if current := entry.values(attr.Type); !containsFold(current, attr.Value) {
+			entry.set(attr.Type, append(current, attr.Value))
+		}
+	}
+
+	delete(m.entries, key)
+	entry.dn = newDN
+	m.entries[newKey] = entry
+
+	for childKey, child := range m.entries {
+		if strings.HasSuffix(childKey, ","+key) {
+			delete(m.entries, childKey)
+			child.dn = relativeDN(child.dn, countRDNs(childKey)-countRDNs(key)) + "," + newDN
+			m.entries[childKey[:len(childKey)-len(key)]+newKey] = child
+		}
+	}
+	return nil
+}
+
+// relativeDN returns the first n RDNs of dn
+func relativeDN(dn string, n int) string {
+	var rdns []string
+	for i := 0; i < n; i++ {
+		var rdn string
+		rdn, dn = splitDN(dn)
+		rdns = append(rdns, rdn)
+	}
+	return strings.Join(rdns, ",")
+}
+
+func countRDNs(dn string) int {
+	n := 0
+	for dn != "" {
+		_, dn = splitDN(dn)
+		n++
+	}
+	return n
+}
+
+// Del removes a leaf entry
+func (m *MemoryDirectory) Del(req *ldap.DelRequest) error {
+	key, err := normalizeDN(req.DN)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.entries[key]; !ok {
+		return ldap.NewError(ldap.LDAPResultNoSuchObject, fmt.Errorf("entry %s not found", req.DN))
+	}
+	for childKey := range m.entries {
+		if strings.HasSuffix(childKey, ","+key) {
+			return ldap.NewError(ldap.LDAPResultNotAllowedOnNonLeaf, fmt.Errorf("entry %s has children", req.DN))
+		}
+	}
+	delete(m.entries, key)
+	return nil
+}
+
+// Entry returns a copy of the entry with the given DN, or nil
+func (m *MemoryDirectory) Entry(dn string) *ldap.Entry {
+	key, err := normalizeDN(dn)
+	if err != nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	return entry.toEntry(nil)
+}
+
+// DNs lists the DNs of all the entries
+func (m *MemoryDirectory) DNs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dns := make([]string, 0, len(m.entries))
+	for _, entry := range m.entries {
+		dns = append(dns, entry.dn)
+	}
+	sort.Strings(dns)
+	return dns
+}
+
+// matchFilter evaluates a filter compiled by ldap.CompileFilter against an
+// entry. Extensible matches are not supported.
+func matchFilter(entry *memoryEntry, filter *ber.Packet) (bool, error) {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			match, err := matchFilter(entry, child)
+			if err != nil || !match {
+				return false, err
+			}
+		}
+		return true, nil
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			match, err := matchFilter(entry, child)
+			if err != nil || match {
+				return match, err
+			}
+		}
+		return false, nil
+	case ldap.FilterNot:
+		if len(filter.Children) != 1 {
+			return false, errors.New("invalid not filter")
+		}
+		match, err := matchFilter(entry, filter.Children[0])
+		return !match, err
+	case ldap.FilterPresent:
+		return len(entry.values(filter.Data.String())) != 0, nil
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch, ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		if len(filter.Children) != 2 {
+			return false, errors.New("invalid filter")
+		}
+		want := filter.Children[1].Data.String()
+		for _, v := range entry.values(filter.Children[0].Data.String()) {
+			if compareValues(v, want, filter.Tag) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterSubstrings:
+		if len(filter.Children) != 2 {
+			return false, errors.New("invalid substrings filter")
+		}
+		for _, v := range entry.values(filter.Children[0].Data.String()) {
+			if matchSubstrings(strings.ToLower(v), filter.Children[1].Children) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, ldap.NewError(ldap.LDAPResultUnwillingToPerform, fmt.Errorf("unsupported filter %s", ldap.FilterMap[uint64(filter.Tag)]))
+}
+
+// compareValues compares as numbers when both sides are, as case insensitive
+// strings otherwise
+func compareValues(have string, want string, op ber.Tag) bool {
+	cmp := strings.Compare(strings.ToLower(have), strings.ToLower(want))
+	if h, err := strconv.ParseInt(have, 10, 64); err == nil {
+		if w, err := strconv.ParseInt(want, 10, 64); err == nil {
+			cmp = 0
+			if h < w {
+				cmp = -1
+			} else if h > w {
+				cmp = 1
+			}
+		}
+	}
+	switch op {
+	case ldap.FilterGreaterOrEqual:
+		return cmp >= 0
+	case ldap.FilterLessOrEqual:
+		return cmp <= 0
+	}
+	return cmp == 0
+}
+
+func matchSubstrings(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		s := strings.ToLower(part.Data.String())
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, s) {
+				return false
+			}
+			value = value[len(s):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(value, s)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(s):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, s) {
+				return false
+			}
+			value = ""
+		}
+	}
+	return true
+}
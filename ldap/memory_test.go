@@ -0,0 +1,652 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestMemoryDirectorySearch(t *testing.T) {
+	dir := NewMemoryDirectory()
+	for dn, attrs := range map[string]map[string][]string{
+		"ou=People,dc=digitalis,dc=io":                 {"objectClass": {"organizationalUnit"}, "ou": {"People"}},
+		"uid=alice,ou=People,dc=digitalis,dc=io":       {"objectClass": {"posixAccount"}, "uid": {"alice"}, "uidNumber": {"1000"}},
+		"uid=bob,ou=People,dc=digitalis,dc=io":         {"objectClass": {"posixAccount"}, "uid": {"bob"}, "uidNumber": {"1500"}},
+		"cn=admins,ou=Groups,dc=digitalis,dc=io":       {"objectClass": {"posixGroup"}, "cn": {"admins"}, "memberUid": {"alice"}},
+		"uid=carol,ou=People,dc=example,dc=org":        {"objectClass": {"posixAccount"}, "uid": {"carol"}},
+		"uid=dave,ou=Old,ou=People,dc=digitalis,dc=io": {"objectClass": {"posixAccount"}, "uid": {"dave"}},
+	} {
+		if err := dir.Add(newAddRequest(dn, nil, attrs)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		base   string
+		scope  int
+		filter string
+		want   []string
+	}{
+		{"dc=digitalis,dc=io", ldap.ScopeWholeSubtree, "(uid=ALICE)", []string{"uid=alice,ou=People,dc=digitalis,dc=io"}},
+		{"dc=digitalis,dc=io", ldap.ScopeWholeSubtree, "(&(objectclass=posixGroup)(memberUid=alice))", []string{"cn=admins,ou=Groups,dc=digitalis,dc=io"}},
+		{"dc=digitalis,dc=io", ldap.ScopeWholeSubtree, "(|(uid=bob)(cn=admins))", []string{"cn=admins,ou=Groups,dc=digitalis,dc=io", "uid=bob,ou=People,dc=digitalis,dc=io"}},
+		{"dc=digitalis,dc=io", ldap.ScopeWholeSubtree, "(uidNumber>=1200)", []string{"uid=bob,ou=People,dc=digitalis,dc=io"}},
+		{"dc=digitalis,dc=io", ldap.ScopeWholeSubtree, "(&(uid=*)(!(uid=a*)))", []string{"uid=bob,ou=People,dc=digitalis,dc=io", "uid=dave,ou=Old,ou=People,dc=digitalis,dc=io"}},
+		{"ou=people,dc=digitalis,dc=io", ldap.ScopeSingleLevel, "(objectClass=posixAccount)", []string{"uid=alice,ou=People,dc=digitalis,dc=io", "uid=bob,ou=People,dc=digitalis,dc=io"}},
+		{"ou=People,dc=digitalis,dc=io", ldap.ScopeBaseObject, "(objectClass=*)", []string{"ou=People,dc=digitalis,dc=io"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			result, err := dir.Search(ldap.NewSearchRequest(tt.base, tt.scope, ldap.NeverDerefAliases, 0, 0, false, tt.filter, []string{"uid"}, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range result.Entries {
+				got = append(got, e.DN)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryDirectoryClient(t *testing.T) {
+	dir := NewMemoryDirectory()
+	c := NewDirectoryClient(Config{BaseDN: "dc=digitalis,dc=io", PasswordScheme: SchemeSSHA512}, dir)
+
+	user := ldapv1.LdapUserSpec{Username: "user01", UID: "1000", GID: "1000", Password: "letmein", Shell: "/bin/bash"}
+	dn, changes, err := c.AddUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes, []string{EntryChange}) {
+		t.Errorf("changes = %v, want the entry created", changes)
+	}
+	// writing the same spec again changes nothing
+	if _, changes, err := c.AddUser(user); err != nil || len(changes) != 0 {
+		t.Errorf("AddUser() again = %v, %v", changes, err)
+	}
+	if dn != "uid=user01,ou=People,dc=digitalis,dc=io" {
+		t.Errorf("DN = %s", dn)
+	}
+	entry := dir.Entry(dn)
+	if entry == nil {
+		t.Fatal("user not added")
+	}
+	if !CheckPassword("letmein", entry.GetAttributeValue("userPassword")) {
+		t.Errorf("userPassword %s doesn't match", entry.GetAttributeValue("userPassword"))
+	}
+
+	// members that are not in LDAP are left out
+	group := ldapv1.LdapGroupSpec{Name: "admins", GID: "2000", Members: []string{"user01", "ghost"}}
+	if _, _, err := c.AddGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if got := dir.Entry("cn=admins,ou=Groups,dc=digitalis,dc=io").GetAttributeValues("memberUid"); !reflect.DeepEqual(got, []string{"user01"}) {
+		t.Errorf("memberUid = %v", got)
+	}
+
+	// legacy setups list uid numbers
+	group.Schema = &ldapv1.GroupSchema{MemberUIDFormat: ldapv1.MemberUIDNumber}
+	if _, _, err := c.AddGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if got, missing, err := c.GroupMembers(group); err != nil || !reflect.DeepEqual(got, []string{"1000"}) || !reflect.DeepEqual(missing, []string{"ghost"}) {
+		t.Errorf("GroupMembers() = %v, %v, %v", got, missing, err)
+	}
+	if got := dir.Entry("cn=admins,ou=Groups,dc=digitalis,dc=io").GetAttributeValues("memberUid"); !reflect.DeepEqual(got, []string{"1000"}) {
+		t.Errorf("memberUid = %v", got)
+	}
+
+	// a change made behind the controller's back shows as drift
+	if err := dir.Modify(&ldap.ModifyRequest{DN: dn, Changes: []ldap.Change{
+		{Operation: ldap.ReplaceAttribute, Modification: ldap.PartialAttribute{Type: "loginShell", Vals: []string{"/bin/sh"}}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	drift, found, err := c.UserDrift(user)
+	if err != nil || !found || !reflect.DeepEqual(drift, []string{"loginShell"}) {
+		t.Errorf("UserDrift() = %v, %v, %v", drift, found, err)
+	}
+
+	// a new OU moves the entry
+	user.OU = "ou=Staff"
+	if dn, changes, err = c.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes, []string{"dn", "loginShell"}) {
+		t.Errorf("changes = %v, want [dn loginShell]", changes)
+	}
+	if dn != "uid=user01,ou=Staff,dc=digitalis,dc=io" || dir.Entry("uid=user01,ou=People,dc=digitalis,dc=io") != nil {
+		t.Errorf("user not moved, entries %v", dir.DNs())
+	}
+	if got := dir.Entry(dn).GetAttributeValue("loginShell"); got != "/bin/bash" {
+		t.Errorf("loginShell = %s, want /bin/bash", got)
+	}
+
+	// numbers held by other entries are reported with the owner's DN
+	if owner, err := c.UIDNumberOwner("1000", "user02"); err != nil || owner != dn {
+		t.Errorf("UIDNumberOwner() = %s, %v", owner, err)
+	}
+	if owner, err := c.UIDNumberOwner("1000", "user01"); err != nil || owner != "" {
+		t.Errorf("UIDNumberOwner() of own number = %s, %v", owner, err)
+	}
+	if owner, err := c.GIDNumberOwner("2000", "staff"); err != nil || owner != "cn=admins,ou=Groups,dc=digitalis,dc=io" {
+		t.Errorf("GIDNumberOwner() = %s, %v", owner, err)
+	}
+
+	if err := c.DeleteUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if dns := dir.DNs(); len(dns) != 0 {
+		t.Errorf("entries left: %v", dns)
+	}
+}
+
+func TestMemoryDirectoryCleartextPassword(t *testing.T) {
+	dir := NewMemoryDirectory()
+	c := NewDirectoryClient(Config{BaseDN: "dc=digitalis,dc=io"}, dir)
+
+	user := ldapv1.LdapUserSpec{Username: "user01", UID: "1000", GID: "1000", Password: "secret"}
+	dn, _, err := c.AddUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stored in cleartext by another tool
+	if err := dir.Modify(&ldap.ModifyRequest{DN: dn, Changes: []ldap.Change{
+		{Operation: ldap.ReplaceAttribute, Modification: ldap.PartialAttribute{Type: "userPassword", Vals: []string{"secret"}}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, changes, err := c.AddUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes, []string{"userPassword"}) {
+		t.Errorf("changes = %v, want the password rewritten", changes)
+	}
+	if got := dir.Entry(dn).GetAttributeValue("userPassword"); !IsHashed(got) || !CheckPassword("secret", got) {
+		t.Errorf("userPassword = %s, want it hashed", got)
+	}
+}
+
+func TestMemoryDirectoryGroupSchema(t *testing.T) {
+	dir := NewMemoryDirectory()
+	c := NewDirectoryClient(Config{
+		BaseDN:      "dc=digitalis,dc=io",
+		GroupSchema: ldapv1.GroupSchema{Mode: ldapv1.GroupSchemaGroupOfNames},
+	}, dir)
+
+	user := ldapv1.LdapUserSpec{Username: "user01", UID: "1000", GID: "1000", OU: "ou=Staff"}
+	userDN, _, err := c.AddUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty group lists itself
+	group := ldapv1.LdapGroupSpec{Name: "admins", GID: "2000"}
+	dn, _, err := c.AddGroup(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := dir.Entry(dn)
+	if got := entry.GetAttributeValues("objectClass"); !reflect.DeepEqual(got, []string{"groupOfNames", "posixGroup"}) {
+		t.Errorf("objectClass = %v", got)
+	}
+	if got := entry.GetAttributeValues("member"); !reflect.DeepEqual(got, []string{dn}) {
+		t.Errorf("member = %v", got)
+	}
+
+	// members are found wherever the user entry lives
+	group.Members = []string{"user01", "ghost"}
+	if _, _, err := c.AddGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	entry = dir.Entry(dn)
+	if got := entry.GetAttributeValues("member"); !reflect.DeepEqual(got, []string{userDN}) {
+		t.Errorf("member = %v, want %s", got, userDN)
+	}
+	if got := entry.GetAttributeValues("memberUid"); len(got) != 0 {
+		t.Errorf("memberUid = %v, want none", got)
+	}
+	if got, _, err := c.GroupMembers(group); err != nil || !reflect.DeepEqual(got, []string{userDN}) {
+		t.Errorf("GroupMembers() = %v, %v", got, err)
+	}
+
+	// the group's own schema wins, and can keep memberUid
+	group.Schema = &ldapv1.GroupSchema{Mode: ldapv1.GroupSchemaGroupOfUniqueNames, MemberUID: true}
+	if _, _, err := c.AddGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	entry = dir.Entry(dn)
+	if got := entry.GetAttributeValues("uniqueMember"); !reflect.DeepEqual(got, []string{userDN}) {
+		t.Errorf("uniqueMember = %v", got)
+	}
+	if got := entry.GetAttributeValues("member"); len(got) != 0 {
+		t.Errorf("member = %v, want none", got)
+	}
+	if got := entry.GetAttributeValues("memberUid"); !reflect.DeepEqual(got, []string{"user01"}) {
+		t.Errorf("memberUid = %v", got)
+	}
+	if drift, _, err := c.GroupDrift(group); err != nil || len(drift) != 0 {
+		t.Errorf("GroupDrift() = %v, %v", drift, err)
+	}
+	if got := entry.GetAttributeValues("objectClass"); containsFold(got, "groupOfNames") {
+		t.Errorf("objectClass = %v, want groupOfNames removed", got)
+	}
+
+	// switching back to RFC2307 removes the member DNs and their objectClass
+	group.Schema = &ldapv1.GroupSchema{Mode: ldapv1.GroupSchemaRFC2307}
+	if drift, _, err := c.GroupDrift(group); err != nil || len(drift) == 0 {
+		t.Errorf("GroupDrift() = %v, %v, want the old schema reported", drift, err)
+	}
+	if _, _, err := c.AddGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	entry = dir.Entry(dn)
+	if got := entry.GetAttributeValues("objectClass"); !reflect.DeepEqual(got, []string{"posixGroup"}) {
+		t.Errorf("objectClass = %v, want [posixGroup]", got)
+	}
+	if got := append(entry.GetAttributeValues("member"), entry.GetAttributeValues("uniqueMember")...); len(got) != 0 {
+		t.Errorf("member DNs = %v, want none", got)
+	}
+	if got := entry.GetAttributeValues("memberUid"); !reflect.DeepEqual(got, []string{"user01"}) {
+		t.Errorf("memberUid = %v", got)
+	}
+	if drift, _, err := c.GroupDrift(group); err != nil || len(drift) != 0 {
+		t.Errorf("GroupDrift() after switching back = %v, %v", drift, err)
+	}
+}
+
+// countingDirectory counts the searches made through it
+type countingDirectory struct {
+	Directory
+	searches int
+}
+
+func (d *countingDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d.searches++
+	return d.Directory.Search(req)
+}
+
+func TestMemoryDirectoryGroupMembersSearch(t *testing.T) {
+	dir := &countingDirectory{Directory: NewMemoryDirectory()}
+	c := NewDirectoryClient(Config{BaseDN: "dc=digitalis,dc=io"}, dir)
+	var members []string
+	for i := 0; i < memberSearchBatch+10; i++ {
+		user := ldapv1.LdapUserSpec{Username: fmt.Sprintf("user%03d", i), UID: strconv.Itoa(1000 + i), GID: "1000"}
+		if _, _, err := c.AddUser(user); err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, user.Username)
+	}
+	// by number, disabled, without an account, and missing
+	members = append(members, "1001", "5000", "ghost")
+	disabled := ldapv1.LdapUserSpec{Username: "disabled", UID: "1999", GID: "1000", ExpiresOn: "1970-01-02"}
+	if _, _, err := c.AddUser(disabled); err != nil {
+		t.Fatal(err)
+	}
+	members = append(members, "disabled")
+
+	dir.searches = 0
+	got, missing, err := c.GroupMembers(ldapv1.LdapGroupSpec{Name: "staff", GID: "2000", Members: members})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.searches != 2 {
+		t.Errorf("%d searches for %d members, want 2", dir.searches, len(members))
+	}
+	want := append(append([]string{}, members[:memberSearchBatch+10]...), "user001", "5000")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupMembers() = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(missing, []string{"ghost", "disabled"}) {
+		t.Errorf("missing = %v, want [ghost disabled]", missing)
+	}
+}
+
+func TestMemoryDirectoryAdopt(t *testing.T) {
+	dir := NewMemoryDirectory()
+	c := NewDirectoryClient(Config{BaseDN: "dc=digitalis,dc=io"}, dir)
+	if err := dir.Add(newAddRequest("uid=old,ou=Legacy,dc=digitalis,dc=io", userObjectClasses, map[string][]string{
+		"uid":           {"old"},
+		"cn":            {"Old Timer"},
+		"uidNumber":     {"500"},
+		"gidNumber":     {"100"},
+		"homeDirectory": {"/export/home/old"},
+		"loginShell":    {"/bin/ksh"},
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exists, err := c.AdoptUser(ldapv1.LdapUserSpec{Username: "new"}); err != nil || exists {
+		t.Errorf("AdoptUser() of a new user = %v, %v", exists, err)
+	}
+
+	user, exists, err := c.AdoptUser(ldapv1.LdapUserSpec{Username: "old", Shell: "/bin/bash"})
+	if err != nil || !exists {
+		t.Fatalf("AdoptUser() = %v, %v", exists, err)
+	}
+	want := ldapv1.LdapUserSpec{
+		Username: "old",
+		UID:      "500",
+		GID:      "100",
+		Homedir:  "/export/home/old",
+		Shell:    "/bin/bash",
+		Gecos:    "Old Timer",
+		OU:       "ou=Legacy",
+	}
+	if !reflect.DeepEqual(user, want) {
+		t.Errorf("AdoptUser() = %+v, want %+v", user, want)
+	}
+
+	// writing the adopted spec leaves the entry where it is
+	dn, _, err := c.AddUser(user)
+	if err != nil || dn != "uid=old,ou=Legacy,dc=digitalis,dc=io" {
+		t.Errorf("AddUser() = %s, %v", dn, err)
+	}
+	if got := dir.Entry(dn).GetAttributeValue("loginShell"); got != "/bin/bash" {
+		t.Errorf("loginShell = %s, want /bin/bash", got)
+	}
+}
+
+func TestMemoryDirectoryAdoptGroup(t *testing.T) {
+	dir := NewMemoryDirectory()
+	c := NewDirectoryClient(Config{BaseDN: "dc=digitalis,dc=io", GroupSchema: ldapv1.GroupSchema{Mode: ldapv1.GroupSchemaGroupOfNames}}, dir)
+	for _, username := range []string{"user01", "user02"} {
+		if _, _, err := c.AddUser(ldapv1.LdapUserSpec{Username: username, UID: "1000", GID: "1000"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	groupDN := "cn=admins,ou=Groups,dc=digitalis,dc=io"
+	if err := dir.Add(newAddRequest(groupDN, []string{"groupOfNames", "posixGroup"}, map[string][]string{
+		"cn":        {"admins"},
+		"gidNumber": {"2000"},
+		"member":    {"uid=user01,ou=People,dc=digitalis,dc=io", "uid=gone,ou=People,dc=digitalis,dc=io", groupDN},
+		"memberUid": {"user02"},
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	group, exists, err := c.AdoptGroup(ldapv1.LdapGroupSpec{Name: "admins"})
+	if err != nil || !exists {
+		t.Fatalf("AdoptGroup() = %v, %v", exists, err)
+	}
+	if want := []string{"user02", "user01"}; !reflect.DeepEqual(group.Members, want) {
+		t.Errorf("members = %v, want %v", group.Members, want)
+	}
+
+	// the adopted members are written back as they were
+	if _, _, err := c.AddGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if got := dir.Entry(groupDN).GetAttributeValues("member"); !reflect.DeepEqual(got, []string{"uid=user02,ou=People,dc=digitalis,dc=io", "uid=user01,ou=People,dc=digitalis,dc=io"}) {
+		t.Errorf("member = %v", got)
+	}
+
+	// members that can't be mapped to a username refuse the adoption
+	if err := dir.Add(newAddRequest("cn=nested,ou=Groups,dc=digitalis,dc=io", []string{"groupOfNames", "posixGroup"}, map[string][]string{
+		"cn":        {"nested"},
+		"gidNumber": {"2001"},
+		"member":    {groupDN},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.AdoptGroup(ldapv1.LdapGroupSpec{Name: "nested"}); err == nil || !strings.Contains(err.Error(), "has no uid") {
+		t.Errorf("AdoptGroup() of a nested group = %v", err)
+	}
+}
+
+func TestMemoryDirectoryCNTemplate(t *testing.T) {
+	dir := NewMemoryDirectory()
+	c := NewDirectoryClient(Config{BaseDN: "dc=digitalis,dc=io", UserDNTemplate: "cn={{.Name}},{{.OU}},{{.BaseDN}}"}, dir)
+	user := ldapv1.LdapUserSpec{Username: "user01", UID: "10001", GID: "10001", Gecos: "Jane Doe"}
+	dn, _, err := c.AddUser(user)
+	if err != nil || dn != "cn=user01,ou=People,dc=digitalis,dc=io" {
+		t.Fatalf("AddUser() = %s, %v", dn, err)
+	}
+
+	// changing gecos leaves the cn naming the entry alone
+	user.Gecos = "Jane Smith"
+	if _, _, err := c.AddUser(user); err != nil {
+		t.Fatalf("AddUser() = %v", err)
+	}
+	entry := dir.Entry(dn)
+	if cn, gecos := entry.GetAttributeValue("cn"), entry.GetAttributeValue("gecos"); cn != "user01" || gecos != "Jane Smith" {
+		t.Errorf("cn, gecos = %s, %s, want user01, Jane Smith", cn, gecos)
+	}
+}
+
+func TestMemoryDirectoryShadow(t *testing.T) {
+	dir := NewMemoryDirectory()
+	c := NewDirectoryClient(Config{BaseDN: "dc=digitalis,dc=io"}, dir)
+
+	maxAge, warning := int64(90), int64(7)
+	user := ldapv1.LdapUserSpec{Username: "contractor", UID: "1000", GID: "1000",
+		ExpiresOn: "2024-01-31", PasswordMaxAge: &maxAge, PasswordWarningDays: &warning}
+	dn, _, err := c.AddUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := dir.Entry(dn)
+	for name, want := range map[string]string{"shadowExpire": "19753", "shadowMax": "90", "shadowWarning": "7", "shadowMin": ""} {
+		if got := entry.GetAttributeValue(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if drift, _, err := c.UserDrift(user); err != nil || len(drift) != 0 {
+		t.Errorf("UserDrift() = %v, %v", drift, err)
+	}
+
+	adopted, _, err := c.AdoptUser(ldapv1.LdapUserSpec{Username: "contractor"})
+	if err != nil || adopted.ExpiresOn != user.ExpiresOn || adopted.PasswordMaxAge == nil || *adopted.PasswordMaxAge != maxAge || adopted.PasswordMinAge != nil {
+		t.Errorf("AdoptUser() = %+v, %v", adopted, err)
+	}
+
+	// clearing the fields removes the attributes
+	user.ExpiresOn, user.PasswordMaxAge, user.PasswordWarningDays = "", nil, nil
+	if _, _, err := c.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+	entry = dir.Entry(dn)
+	if entry.GetAttributeValue("shadowExpire") != "" || entry.GetAttributeValue("shadowMax") != "" {
+		t.Errorf("shadow attributes left after clearing: %v", entry.Attributes)
+	}
+
+	user.ExpiresOn = "31/01/2024"
+	if _, _, err := c.AddUser(user); err == nil {
+		t.Error("AddUser() accepted an invalid expiry date")
+	}
+}
+
+func TestMemoryDirectorySSHKeys(t *testing.T) {
+	dir := NewMemoryDirectory()
+	c := NewDirectoryClient(Config{BaseDN: "dc=digitalis,dc=io"}, dir)
+
+	user := ldapv1.LdapUserSpec{Username: "user01", UID: "1000", GID: "1000"}
+	dn, _, err := c.AddUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ocs := dir.Entry(dn).GetAttributeValues("objectClass"); containsFold(ocs, "ldapPublicKey") {
+		t.Errorf("objectClass = %v, want no ldapPublicKey without keys", ocs)
+	}
+
+	user.SSHPublicKeys = []string{"ssh-ed25519 AAAA1 a", "ssh-ed25519 AAAA2 b"}
+	if _, _, err := c.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+	entry := dir.Entry(dn)
+	if ocs := entry.GetAttributeValues("objectClass"); !containsFold(ocs, "ldapPublicKey") {
+		t.Errorf("objectClass = %v, want ldapPublicKey", ocs)
+	}
+	if got := entry.GetAttributeValues("sshPublicKey"); !reflect.DeepEqual(got, user.SSHPublicKeys) {
+		t.Errorf("sshPublicKey = %v, want %v", got, user.SSHPublicKeys)
+	}
+	if adopted, _, err := c.AdoptUser(ldapv1.LdapUserSpec{Username: "user01"}); err != nil || !reflect.DeepEqual(adopted.SSHPublicKeys, user.SSHPublicKeys) {
+		t.Errorf("AdoptUser() keys = %v, %v", adopted.SSHPublicKeys, err)
+	}
+
+	user.SSHPublicKeys = user.SSHPublicKeys[1:]
+	if _, _, err := c.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if got := dir.Entry(dn).GetAttributeValues("sshPublicKey"); !reflect.DeepEqual(got, user.SSHPublicKeys) {
+		t.Errorf("sshPublicKey = %v, want %v", got, user.SSHPublicKeys)
+	}
+}
+
+func TestMemoryDirectoryExtraAttributes(t *testing.T) {
+	dir := NewMemoryDirectory()
+	c := NewDirectoryClient(Config{BaseDN: "dc=digitalis,dc=io"}, dir)
+
+	user := ldapv1.LdapUserSpec{Username: "user01", UID: "1000", GID: "1000",
+		ExtraObjectClasses: []string{"extensibleObject"},
+		Attributes: map[string][]string{
+			"mail":        {"user01@example.com", "u1@example.com"},
+			"description": {"One"},
+			"loginShell":  {"/bin/false"},
+		}}
+	dn, _, err := c.AddUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := dir.Entry(dn)
+	if ocs := entry.GetAttributeValues("objectClass"); !containsFold(ocs, "extensibleObject") || !containsFold(ocs, "posixAccount") {
+		t.Errorf("objectClass = %v", ocs)
+	}
+	if got := entry.GetAttributeValues("mail"); !reflect.DeepEqual(got, user.Attributes["mail"]) {
+		t.Errorf("mail = %v, want %v", got, user.Attributes["mail"])
+	}
+	// reserved attributes are left to the controller
+	if got := entry.GetAttributeValue("loginShell"); got != "" {
+		t.Errorf("loginShell = %s, want it unset", got)
+	}
+	if drift, _, err := c.UserDrift(user); err != nil || len(drift) != 0 {
+		t.Errorf("UserDrift() = %v, %v", drift, err)
+	}
+
+	// an empty list removes the attribute, a missing one is left alone
+	user.Attributes = map[string][]string{"mail": {}}
+	if _, _, err := c.AddUser(user); err != nil {
+		t.Fatal(err)
+	}
+	entry = dir.Entry(dn)
+	if entry.GetAttributeValue("mail") != "" || entry.GetAttributeValue("description") != "One" {
+		t.Errorf("attributes after update = %v", entry.Attributes)
+	}
+
+	group := ldapv1.LdapGroupSpec{Name: "staff", GID: "2000",
+		ExtraObjectClasses: []string{"extensibleObject"},
+		Attributes:         map[string][]string{"description": {"Staff"}, "memberUid": {"root"}}}
+	groupDN, _, err := c.AddGroup(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupEntry := dir.Entry(groupDN)
+	if groupEntry.GetAttributeValue("description") != "Staff" || len(groupEntry.GetAttributeValues("memberUid")) != 0 ||
+		!containsFold(groupEntry.GetAttributeValues("objectClass"), "extensibleObject") {
+		t.Errorf("group entry = %v", groupEntry.Attributes)
+	}
+	if drift, _, err := c.GroupDrift(group); err != nil || len(drift) != 0 {
+		t.Errorf("GroupDrift() = %v, %v", drift, err)
+	}
+}
+
+func TestMemoryDirectoryDeletionPolicy(t *testing.T) {
+	dir := NewMemoryDirectory()
+	c := NewDirectoryClient(Config{BaseDN: "dc=digitalis,dc=io", DeletionPolicy: ldapv1.DeletionPolicyDisable}, dir)
+
+	user := ldapv1.LdapUserSpec{Username: "user01", UID: "1000", GID: "1000", Shell: "/bin/bash"}
+	dn, _, err := c.AddUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := ldapv1.LdapUserSpec{Username: "user02", UID: "1001", GID: "1000"}
+	if _, _, err := c.AddUser(other); err != nil {
+		t.Fatal(err)
+	}
+	group := ldapv1.LdapGroupSpec{Name: "staff", GID: "2000", Members: []string{"user01", "user02"}}
+	groupDN, _, err := c.AddGroup(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	named := ldapv1.LdapGroupSpec{Name: "admins", GID: "2001", Members: []string{"user01"}, Schema: &ldapv1.GroupSchema{Mode: ldapv1.GroupSchemaGroupOfNames}}
+	namedDN, _, err := c.AddGroup(named)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server's policy locks the account and strips its memberships
+	if policy, err := c.RemoveUser(user); err != nil || policy != ldapv1.DeletionPolicyDisable {
+		t.Fatalf("RemoveUser() = %s, %v", policy, err)
+	}
+	entry := dir.Entry(dn)
+	if entry == nil || entry.GetAttributeValue("shadowExpire") != "1" || entry.GetAttributeValue("loginShell") != "/sbin/nologin" {
+		t.Errorf("user not disabled: %v", entry)
+	}
+	if got := dir.Entry(groupDN).GetAttributeValues("memberUid"); !reflect.DeepEqual(got, []string{"user02"}) {
+		t.Errorf("memberUid = %v", got)
+	}
+	if got := dir.Entry(namedDN).GetAttributeValues("member"); !reflect.DeepEqual(got, []string{namedDN}) {
+		t.Errorf("member = %v", got)
+	}
+	// and groups listing it don't add it back
+	if _, _, err := c.AddGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if got := dir.Entry(groupDN).GetAttributeValues("memberUid"); !reflect.DeepEqual(got, []string{"user02"}) {
+		t.Errorf("memberUid after resync = %v", got)
+	}
+
+	// the object's own policy wins
+	other.DeletionPolicy = ldapv1.DeletionPolicyRetain
+	if policy, err := c.RemoveUser(other); err != nil || policy != ldapv1.DeletionPolicyRetain {
+		t.Fatalf("RemoveUser() = %s, %v", policy, err)
+	}
+	if entry := dir.Entry("uid=user02,ou=People,dc=digitalis,dc=io"); entry == nil || entry.GetAttributeValue("shadowExpire") != "" {
+		t.Errorf("retained user changed: %v", entry)
+	}
+
+	if _, err := c.RemoveGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if entry := dir.Entry(groupDN); entry == nil || len(entry.GetAttributeValues("memberUid")) != 0 {
+		t.Errorf("group not emptied: %v", entry)
+	}
+	named.DeletionPolicy = ldapv1.DeletionPolicyDelete
+	if _, err := c.RemoveGroup(named); err != nil {
+		t.Fatal(err)
+	}
+	if dir.Entry(namedDN) != nil {
+		t.Error("group not deleted")
+	}
+}
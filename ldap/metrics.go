@@ -0,0 +1,114 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"errors"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Operations recorded in the metrics
+const (
+	opBind     = "bind"
+	opSearch   = "search"
+	opAdd      = "add"
+	opModify   = "modify"
+	opModifyDN = "modifydn"
+	opDelete   = "delete"
+)
+
+var (
+	operationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ldap_operations_total",
+			Help: "Number of LDAP operations by operation and result code",
+		},
+		[]string{"operation", "result"},
+	)
+	operationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ldap_operation_duration_seconds",
+			Help:    "Duration of LDAP operations by operation and result code",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"operation", "result"},
+	)
+
+	poolConnectionsDesc = prometheus.NewDesc(
+		"ldap_pool_connections",
+		"Open connections to the LDAP server by state",
+		[]string{"server", "state"}, nil,
+	)
+	poolMaxConnectionsDesc = prometheus.NewDesc(
+		"ldap_pool_max_connections",
+		"Maximum number of connections kept to the LDAP server",
+		[]string{"server"}, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(operationsTotal, operationDuration)
+}
+
+// resultCode names the LDAP result code of err
+func resultCode(err error) string {
+	if err == nil {
+		return ldap.LDAPResultCodeMap[ldap.LDAPResultSuccess]
+	}
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) {
+		if name, ok := ldap.LDAPResultCodeMap[ldapErr.ResultCode]; ok {
+			return name
+		}
+	}
+	return "Other"
+}
+
+// observe records an operation that started at start and ended with err
+func observe(operation string, start time.Time, err error) {
+	result := resultCode(err)
+	operationsTotal.WithLabelValues(operation, result).Inc()
+	operationDuration.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
+
+// Describe implements prometheus.Collector
+func (cc *ClientCache) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolConnectionsDesc
+	ch <- poolMaxConnectionsDesc
+}
+
+// Collect implements prometheus.Collector, reporting the connection pool of
+// every server
+func (cc *ClientCache) Collect(ch chan<- prometheus.Metric) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	for name, c := range cc.clients {
+		pool, ok := c.dir.(*Pool)
+		if !ok {
+			continue
+		}
+		inUse, idle := pool.Stats()
+		ch <- prometheus.MustNewConstMetric(poolConnectionsDesc, prometheus.GaugeValue, float64(inUse), name, "in_use")
+		ch <- prometheus.MustNewConstMetric(poolConnectionsDesc, prometheus.GaugeValue, float64(idle), name, "idle")
+		ch <- prometheus.MustNewConstMetric(poolMaxConnectionsDesc, prometheus.GaugeValue, float64(cap(pool.slots)), name)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"sort"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// attrValues drops empty values so that unset spec fields are not written
+func attrValues(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// sortedKeys returns the attribute names in a stable order
+func sortedKeys(attrs map[string][]string) []string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sameValues compares two multi-valued attributes ignoring their order
+func sameValues(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string{}, a...)
+	y := append([]string{}, b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// withExtraObjectClasses returns objectClasses followed by the extra ones it
+// doesn't hold yet
+func withExtraObjectClasses(objectClasses []string, extra []string) []string {
+	out := append([]string{}, objectClasses...)
+	for _, oc := range extra {
+		if !containsFold(out, oc) {
+			out = append(out, oc)
+		}
+	}
+	return out
+}
+
+// addExtraAttributes merges the attributes set in the spec into attrs,
+// leaving out the reserved ones the controller writes itself
+func addExtraAttributes(attrs map[string][]string, extra map[string][]string, reserved func(string) bool) {
+	for _, name := range sortedKeys(extra) {
+		if reserved(name) {
+			continue
+		}
+		attrs[name] = attrValues(extra[name]...)
+	}
+}
+
+// newAddRequest builds the request creating an entry with the given
+// objectClasses and attributes
+func newAddRequest(dn string, objectClasses []string, attrs map[string][]string) *ldap.AddRequest {
+	addReq := ldap.NewAddRequest(dn, []ldap.Control{})
+	addReq.Attribute("objectClass", objectClasses)
+	for _, name := range sortedKeys(attrs) {
+		if len(attrs[name]) != 0 {
+			addReq.Attribute(name, attrs[name])
+		}
+	}
+	return addReq
+}
+
+// newModifyRequest returns the minimal changes turning entry into one holding
+// the given objectClasses and attributes. Missing objectClasses are added but
+// never removed, attributes that are wanted empty are deleted.
+func newModifyRequest(entry *ldap.Entry, objectClasses []string, attrs map[string][]string) *ldap.ModifyRequest {
+	modReq := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
+
+	var missing []string
+	current := entry.GetEqualFoldAttributeValues("objectClass")
+	for _, oc := range objectClasses {
+		found := false
+		for _, c := range current {
+			if strings.EqualFold(oc, c) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, oc)
+		}
+	}
+	if len(missing) != 0 {
+		modReq.Add("objectClass", missing)
+	}
+
+	for _, name := range sortedKeys(attrs) {
+		want := attrs[name]
+		have := entry.GetEqualFoldAttributeValues(name)
+		switch {
+		case len(want) == 0 && len(have) == 0:
+		case len(want) == 0:
+			modReq.Delete(name, []string{})
+		case len(have) == 0:
+			modReq.Add(name, want)
+		case !sameValues(want, have):
+			modReq.Replace(name, want)
+		}
+	}
+	return modReq
+}
+
+// changedAttributes lists the attributes a modify request touches
+func changedAttributes(modReq *ldap.ModifyRequest) []string {
+	var names []string
+	for _, change := range modReq.Changes {
+		names = append(names, change.Modification.Type)
+	}
+	return names
+}
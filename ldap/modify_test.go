@@ -0,0 +1,103 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"reflect"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestNewModifyRequest(t *testing.T) {
+	entry := ldap.NewEntry("uid=user01,ou=People,dc=digitalis,dc=io", map[string][]string{
+		"objectClass":   {"top", "posixAccount", "account"},
+		"uid":           {"user01"},
+		"uidNumber":     {"1000"},
+		"gidNumber":     {"1000"},
+		"loginShell":    {"/bin/sh"},
+		"homeDirectory": {"/home/user01"},
+		"memberUid":     {"b", "a"},
+	})
+
+	modReq := newModifyRequest(entry, []string{"top", "posixAccount", "shadowAccount"}, map[string][]string{
+		"uid":           {"user01"},
+		"uidNumber":     {"1000"},
+		"gidNumber":     {"2000"},
+		"loginShell":    nil,
+		"homeDirectory": {"/home/user01"},
+		"gecos":         {"user01"},
+		"memberUid":     {"a", "b"},
+	})
+
+	want := []ldap.Change{
+		{Operation: ldap.AddAttribute, Modification: ldap.PartialAttribute{Type: "objectClass", Vals: []string{"shadowAccount"}}},
+		{Operation: ldap.AddAttribute, Modification: ldap.PartialAttribute{Type: "gecos", Vals: []string{"user01"}}},
+		{Operation: ldap.ReplaceAttribute, Modification: ldap.PartialAttribute{Type: "gidNumber", Vals: []string{"2000"}}},
+		{Operation: ldap.DeleteAttribute, Modification: ldap.PartialAttribute{Type: "loginShell", Vals: []string{}}},
+	}
+	if modReq.DN != entry.DN {
+		t.Errorf("DN = %s, want %s", modReq.DN, entry.DN)
+	}
+	if !reflect.DeepEqual(modReq.Changes, want) {
+		t.Errorf("Changes = %+v, want %+v", modReq.Changes, want)
+	}
+}
+
+func TestNewModifyRequestNoChanges(t *testing.T) {
+	entry := ldap.NewEntry("cn=devops,ou=Groups,dc=digitalis,dc=io", map[string][]string{
+		"objectClass": {"posixGroup"},
+		"cn":          {"devops"},
+		"gidNumber":   {"1000"},
+	})
+
+	modReq := newModifyRequest(entry, []string{"posixGroup"}, map[string][]string{
+		"cn":        {"devops"},
+		"gidNumber": {"1000"},
+		"memberUid": nil,
+	})
+	if len(modReq.Changes) != 0 {
+		t.Errorf("expected no changes, got %+v", modReq.Changes)
+	}
+}
+
+func TestChangedAttributes(t *testing.T) {
+	entry := ldap.NewEntry("uid=user01,ou=People,dc=digitalis,dc=io", map[string][]string{
+		"objectClass": {"top", "posixAccount", "account"},
+		"uid":         {"user01"},
+		"loginShell":  {"/bin/sh"},
+		"gecos":       {"User One"},
+	})
+
+	modReq := newModifyRequest(entry, []string{"top", "posixAccount", "account"}, map[string][]string{
+		"uid":        {"user01"},
+		"loginShell": {"/bin/bash"},
+		"gecos":      nil,
+	})
+	if got, want := changedAttributes(modReq), []string{"gecos", "loginShell"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changedAttributes() = %v, want %v", got, want)
+	}
+
+	modReq = newModifyRequest(entry, []string{"top", "posixAccount", "account"}, map[string][]string{
+		"uid":        {"user01"},
+		"loginShell": {"/bin/sh"},
+		"gecos":      {"User One"},
+	})
+	if got := changedAttributes(modReq); len(got) != 0 {
+		t.Errorf("changedAttributes() = %v, want no drift", got)
+	}
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Password schemes supported for userPassword
+const (
+	SchemeSSHA    = "SSHA"
+	SchemeSSHA512 = "SSHA512"
+	SchemeCrypt   = "CRYPT"
+	SchemeArgon2  = "ARGON2"
+)
+
+// DefaultPasswordScheme is used when the server doesn't pick one
+const DefaultPasswordScheme = SchemeSSHA
+
+// argon2id parameters, as recommended by RFC 9106
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+)
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var schemePrefix = regexp.MustCompile(`^\{[A-Za-z0-9.-]+\}`)
+
+// IsHashed tells whether a value already carries a {SCHEME} prefix
+func IsHashed(password string) bool {
+	return schemePrefix.MatchString(password)
+}
+
+// HashPassword returns the userPassword value for password using scheme.
+// Values that are already hashed are returned unchanged.
+func HashPassword(password string, scheme string) (string, error) {
+	if password == "" || IsHashed(password) {
+		return password, nil
+	}
+	if scheme == "" {
+		scheme = DefaultPasswordScheme
+	}
+
+	switch scheme {
+	case SchemeSSHA:
+		return saltedHash("{SSHA}", sha1.New(), password)
+	case SchemeSSHA512:
+		return saltedHash("{SSHA512}", sha512.New(), password)
+	case SchemeCrypt:
+		salt, err := randomBytes(16)
+		if err != nil {
+			return "", err
+		}
+		for i := range salt {
+			salt[i] = cryptAlphabet[int(salt[i])%len(cryptAlphabet)]
+		}
+		return "{CRYPT}" + sha512Crypt([]byte(password), salt), nil
+	case SchemeArgon2:
+		salt, err := randomBytes(16)
+		if err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("{ARGON2}$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	return "", fmt.Errorf("unknown password scheme %s", scheme)
+}
+
+// CheckPassword tells whether a userPassword value matches password. Values
+// in a scheme it cannot verify, and cleartext ones, never match, so they get
+// rewritten hashed.
+func CheckPassword(password string, value string) bool {
+	if IsHashed(password) {
+		return password == value
+	}
+	if !IsHashed(value) {
+		return false
+	}
+
+	prefix := schemePrefix.FindString(value)
+	encoded := value[len(prefix):]
+	switch strings.ToUpper(prefix) {
+	case "{SSHA}":
+		return checkSaltedHash(sha1.New(), password, encoded)
+	case "{SSHA512}":
+		return checkSaltedHash(sha512.New(), password, encoded)
+	case "{CRYPT}":
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 4 || parts[1] != "6" {
+			return false
+		}
+		return subtle.ConstantTimeCompare([]byte(sha512Crypt([]byte(password), []byte(parts[2]))), []byte(encoded)) == 1
+	case "{ARGON2}":
+		var version, memory, iterations, threads int
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 6 || parts[1] != "argon2id" {
+			return false
+		}
+		if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return false
+		}
+		if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+			return false
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+		if err != nil {
+			return false
+		}
+		key, err := base64.RawStdEncoding.DecodeString(parts[5])
+		if err != nil {
+			return false
+		}
+		got := argon2.IDKey([]byte(password), salt, uint32(iterations), uint32(memory), uint8(threads), uint32(len(key)))
+		return subtle.ConstantTimeCompare(got, key) == 1
+	}
+	return false
+}
+
+func checkSaltedHash(h hash.Hash, password string, encoded string) bool {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) < h.Size() {
+		return false
+	}
+	sum, salt := raw[:h.Size()], raw[h.Size():]
+	h.Write([]byte(password))
+	h.Write(salt)
+	return subtle.ConstantTimeCompare(h.Sum(nil), sum) == 1
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// saltedHash builds the {SSHA} style base64(hash(password + salt) + salt)
+func saltedHash(prefix string, h hash.Hash, password string) (string, error) {
+	salt, err := randomBytes(8)
+	if err != nil {
+		return "", err
+	}
+	h.Write([]byte(password))
+	h.Write(salt)
+	return prefix + base64.StdEncoding.EncodeToString(append(h.Sum(nil), salt...)), nil
+}
+
+// sha512Crypt implements the glibc $6$ scheme with the default 5000 rounds,
+// see https://www.akkadia.org/drepper/SHA-crypt.txt
+func sha512Crypt(password []byte, salt []byte) string {
+	const rounds = 5000
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	b := sha512.New()
+	b.Write(password)
+	b.Write(salt)
+	b.Write(password)
+	sumB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(password)
+	a.Write(salt)
+	for n := len(password); n > 0; n -= 64 {
+		if n > 64 {
+			a.Write(sumB)
+		} else {
+			a.Write(sumB[:n])
+		}
+	}
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(sumB)
+		} else {
+			a.Write(password)
+		}
+	}
+	sumA := a.Sum(nil)
+
+	dp := sha512.New()
+	for i := 0; i < len(password); i++ {
+		dp.Write(password)
+	}
+	p := repeatTo(dp.Sum(nil), len(password))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(sumA[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeatTo(ds.Sum(nil), len(salt))
+
+	sum := sumA
+	for i := 0; i < rounds; i++ {
+		c := sha512.New()
+		if i%2 != 0 {
+			c.Write(p)
+		} else {
+			c.Write(sum)
+		}
+		if i%3 != 0 {
+			c.Write(s)
+		}
+		if i%7 != 0 {
+			c.Write(p)
+		}
+		if i%2 != 0 {
+			c.Write(sum)
+		} else {
+			c.Write(p)
+		}
+		sum = c.Sum(nil)
+	}
+
+	out := []byte("$6$")
+	out = append(out, salt...)
+	out = append(out, '$')
+	// bytes are taken in groups of i, i+21, i+42 rotated by one each time
+	for i := 0; i < 21; i++ {
+		g := [3]byte{sum[i], sum[i+21], sum[i+42]}
+		r := i % 3
+		out = append(out, crypt64(g[r], g[(r+1)%3], g[(r+2)%3], 4)...)
+	}
+	out = append(out, crypt64(0, 0, sum[63], 2)...)
+	return string(out)
+}
+
+// repeatTo repeats sum until it is n bytes long
+func repeatTo(sum []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		if n-len(out) >= len(sum) {
+			out = append(out, sum...)
+		} else {
+			out = append(out, sum[:n-len(out)]...)
+		}
+	}
+	return out
+}
+
+func crypt64(b2, b1, b0 byte, n int) []byte {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = cryptAlphabet[w&0x3f]
+		w >>= 6
+	}
+	return out
+}
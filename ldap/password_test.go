@@ -0,0 +1,141 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestSHA512Crypt(t *testing.T) {
+	// vectors from https://www.akkadia.org/drepper/SHA-crypt.txt
+	tests := []struct {
+		salt, password, want string
+	}{
+		{"saltstring", "Hello world!", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{"toolongsaltstringtoolongsaltstring", "This is just a test", "$6$toolongsaltstrin$lQ8jolhgVRVhY4b5pZKaysCLi0QBxGoNeKQzQ3glMhwllF7oGDZxUhx1yxdYcz/e1JSbq3y6JMxxl8audkUEm0"},
+	}
+	for _, tt := range tests {
+		if got := sha512Crypt([]byte(tt.password), []byte(tt.salt)); got != tt.want {
+			t.Errorf("sha512Crypt(%q, %q) = %s, want %s", tt.password, tt.salt, got, tt.want)
+		}
+	}
+}
+
+func checkSalted(t *testing.T, hashed string, prefix string, h hash.Hash, password string) {
+	if !strings.HasPrefix(hashed, prefix) {
+		t.Fatalf("%s has no %s prefix", hashed, prefix)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(hashed, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, salt := raw[:h.Size()], raw[h.Size():]
+	h.Write([]byte(password))
+	h.Write(salt)
+	if !bytes.Equal(h.Sum(nil), sum) {
+		t.Errorf("%s does not match %s", hashed, password)
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hashed, err := HashPassword("letmein", SchemeSSHA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSalted(t, hashed, "{SSHA}", sha1.New(), "letmein")
+
+	hashed, err = HashPassword("letmein", SchemeSSHA512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSalted(t, hashed, "{SSHA512}", sha512.New(), "letmein")
+
+	hashed, err = HashPassword("letmein", SchemeCrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(hashed, "{CRYPT}"), "$")
+	if len(parts) != 4 || parts[1] != "6" {
+		t.Fatalf("unexpected crypt value %s", hashed)
+	}
+	if want := sha512Crypt([]byte("letmein"), []byte(parts[2])); "{CRYPT}"+want != hashed {
+		t.Errorf("%s does not match letmein", hashed)
+	}
+
+	hashed, err = HashPassword("letmein", SchemeArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts = strings.Split(hashed, "$")
+	if len(parts) != 6 || parts[0] != "{ARGON2}" || parts[1] != "argon2id" {
+		t.Fatalf("unexpected argon2 value %s", hashed)
+	}
+	salt, _ := base64.RawStdEncoding.DecodeString(parts[4])
+	key := argon2.IDKey([]byte("letmein"), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	if base64.RawStdEncoding.EncodeToString(key) != parts[5] {
+		t.Errorf("%s does not match letmein", hashed)
+	}
+}
+
+func TestHashPasswordPassThrough(t *testing.T) {
+	for _, value := range []string{"", "{SSHA}abcdef", "{CRYPT}$6$salt$hash", "{SSHA512}x", "{PBKDF2-SHA512}x"} {
+		got, err := HashPassword(value, SchemeSSHA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != value {
+			t.Errorf("HashPassword(%q) = %q, want it unchanged", value, got)
+		}
+	}
+
+	if _, err := HashPassword("letmein", "MD5"); err == nil {
+		t.Error("expected an error for an unknown scheme")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	for _, scheme := range []string{SchemeSSHA, SchemeSSHA512, SchemeCrypt, SchemeArgon2} {
+		hashed, err := HashPassword("letmein", scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !CheckPassword("letmein", hashed) {
+			t.Errorf("%s: %s does not match letmein", scheme, hashed)
+		}
+		if CheckPassword("letmeout", hashed) {
+			t.Errorf("%s: %s matches letmeout", scheme, hashed)
+		}
+	}
+
+	if CheckPassword("letmein", "letmein") {
+		t.Error("cleartext values should not match")
+	}
+	if !CheckPassword("{SSHA}abc", "{SSHA}abc") {
+		t.Error("hashed passwords should be compared as they are")
+	}
+	if CheckPassword("letmein", "{MD5}abc") {
+		t.Error("unknown schemes should not match")
+	}
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// idle connections older than this are rebound before being handed out again,
+// which both checks they are still alive and restores the bind identity
+const healthCheckAfter = 30 * time.Second
+
+var errPoolClosed = errors.New("connection pool is closed")
+
+type idleConn struct {
+	conn  *ldap.Conn
+	since time.Time
+}
+
+// Pool keeps a bounded set of bound connections to a single LDAP server.
+// Every operation borrows a connection for its own duration only, so callers
+// never hold more than one and a small pool cannot deadlock.
+type Pool struct {
+	config Config
+	// slots bounds the number of open connections
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []idleConn
+	closed bool
+}
+
+// NewPool returns a pool opening at most size connections to the server
+func NewPool(config Config, size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		config: config,
+		slots:  make(chan struct{}, size),
+	}
+}
+
+// Get returns a bound connection, waiting for one to be released when all of
+// them are in use. It must be handed back with Put or Discard.
+func (p *Pool) Get() (*ldap.Conn, error) {
+	p.slots <- struct{}{}
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			<-p.slots
+			return nil, errPoolClosed
+		}
+		n := len(p.idle)
+		if n == 0 {
+			p.mu.Unlock()
+			break
+		}
+		ic := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+
+		if p.healthy(ic) {
+			return ic.conn, nil
+		}
+		ic.conn.Close()
+	}
+
+	conn, err := Connect(p.config)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (p *Pool) healthy(ic idleConn) bool {
+	if ic.conn.IsClosing() {
+		return false
+	}
+	if time.Since(ic.since) < healthCheckAfter {
+		return true
+	}
+	start := time.Now()
+	err := ic.conn.Bind(p.config.BindDN, p.config.BindPassword)
+	observe(opBind, start, err)
+	return err == nil
+}
+
+// Put returns a healthy connection to the pool
+func (p *Pool) Put(conn *ldap.Conn) {
+	p.mu.Lock()
+	if p.closed || conn.IsClosing() {
+		p.mu.Unlock()
+		conn.Close()
+	} else {
+		p.idle = append(p.idle, idleConn{conn: conn, since: time.Now()})
+		p.mu.Unlock()
+	}
+	<-p.slots
+}
+
+// Stats returns the number of connections handed out, or being opened, and
+// the number of idle ones
+func (p *Pool) Stats() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.slots), len(p.idle)
+}
+
+// Discard closes a broken connection and frees its slot
+func (p *Pool) Discard(conn *ldap.Conn) {
+	conn.Close()
+	<-p.slots
+}
+
+// Close closes the idle connections, the ones in use are closed as they are
+// handed back
+func (p *Pool) Close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	for _, ic := range idle {
+		ic.conn.Close()
+	}
+}
+
+func (p *Pool) withConn(operation string, fn func(conn *ldap.Conn) error) error {
+	conn, err := p.Get()
+	if err != nil {
+		return fmt.Errorf("Could not connect to ldap server %w", err)
+	}
+	start := time.Now()
+	err = fn(conn)
+	observe(operation, start, err)
+	if err != nil && ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		p.Discard(conn)
+		return err
+	}
+	p.Put(conn)
+	return err
+}
+
+// Search runs a search on a pooled connection
+func (p *Pool) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	var result *ldap.SearchResult
+	err := p.withConn(opSearch, func(conn *ldap.Conn) error {
+		var err error
+		result, err = conn.Search(req)
+		return err
+	})
+	return result, err
+}
+
+// Add runs an add on a pooled connection
+func (p *Pool) Add(req *ldap.AddRequest) error {
+	return p.withConn(opAdd, func(conn *ldap.Conn) error {
+		return conn.Add(req)
+	})
+}
+
+// Modify runs a modify on a pooled connection
+func (p *Pool) Modify(req *ldap.ModifyRequest) error {
+	return p.withConn(opModify, func(conn *ldap.Conn) error {
+		return conn.Modify(req)
+	})
+}
+
+// Del runs a delete on a pooled connection
+func (p *Pool) Del(req *ldap.DelRequest) error {
+	return p.withConn(opDelete, func(conn *ldap.Conn) error {
+		return conn.Del(req)
+	})
+}
+
+// ModifyDN runs a rename on a pooled connection
+func (p *Pool) ModifyDN(req *ldap.ModifyDNRequest) error {
+	return p.withConn(opModifyDN, func(conn *ldap.Conn) error {
+		return conn.ModifyDN(req)
+	})
+}
+
+// ClientCache hands out one Client, and so one connection pool, per server so
+// that every reconciler shares the same connections
+type ClientCache struct {
+	poolSize int
+
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+// NewClientCache returns an empty cache whose clients keep at most poolSize
+// connections each
+func NewClientCache(poolSize int) *ClientCache {
+	return &ClientCache{
+		poolSize: poolSize,
+		clients:  map[string]*Client{},
+	}
+}
+
+// Get returns the cached client for the named server. When the settings have
+// changed since it was created the old client is closed and replaced.
+func (cc *ClientCache) Get(name string, config Config) *Client {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if c, ok := cc.clients[name]; ok {
+		if reflect.DeepEqual(c.config, config) {
+			return c
+		}
+		c.Close()
+	}
+	c := NewClient(config, cc.poolSize)
+	cc.clients[name] = c
+	return c
+}
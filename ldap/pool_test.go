@@ -0,0 +1,207 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ld "ldap-accounts-controller/ldap"
+	"ldap-accounts-controller/ldap/ldaptest"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func newTestServer(t *testing.T) *ldaptest.Server {
+	t.Helper()
+	s, err := ldaptest.NewServer("cn=admin,dc=digitalis,dc=io", "letmein")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func checkStats(t *testing.T, p *ld.Pool, inUse int, idle int) {
+	t.Helper()
+	if gotInUse, gotIdle := p.Stats(); gotInUse != inUse || gotIdle != idle {
+		t.Errorf("Stats() = %d in use, %d idle, want %d, %d", gotInUse, gotIdle, inUse, idle)
+	}
+}
+
+func TestPoolBounds(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	p := ld.NewPool(s.Config(), 2)
+	defer p.Close()
+
+	first, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStats(t, p, 2, 0)
+
+	// a third caller waits for a connection to be handed back
+	got := make(chan error)
+	go func() {
+		conn, err := p.Get()
+		if err == nil {
+			p.Put(conn)
+		}
+		got <- err
+	}()
+	select {
+	case <-got:
+		t.Fatal("Get() returned while every connection was in use")
+	case <-time.After(100 * time.Millisecond):
+	}
+	p.Put(first)
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get() still waiting after a connection was handed back")
+	}
+	p.Put(second)
+	checkStats(t, p, 0, 2)
+	if binds := s.Binds(); binds != 2 {
+		t.Errorf("binds = %d, want 2 as connections are reused", binds)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	p := ld.NewPool(s.Config(), 1)
+	defer p.Close()
+
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(conn)
+
+	// recently used connections are handed out as they are
+	again, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != conn || s.Binds() != 1 {
+		t.Errorf("Get() = new connection or rebind, binds = %d", s.Binds())
+	}
+	p.Put(again)
+
+	// older ones are bound again first
+	ld.AgeIdleConns(p, ld.HealthCheckAfter)
+	again, err = p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != conn || s.Binds() != 2 {
+		t.Errorf("Get() after the health check interval: same = %v, binds = %d, want 2", again == conn, s.Binds())
+	}
+	p.Put(again)
+
+	// and replaced when the server dropped them
+	s.DropConnections()
+	ld.AgeIdleConns(p, ld.HealthCheckAfter)
+	again, err = p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == conn {
+		t.Error("Get() returned a connection the server closed")
+	}
+	p.Put(again)
+	checkStats(t, p, 0, 1)
+}
+
+func TestPoolBrokenConnections(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	p := ld.NewPool(s.Config(), 1)
+	defer p.Close()
+
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Discard(conn)
+	checkStats(t, p, 0, 0)
+
+	// connections closed while in use are not kept
+	conn, err = p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.DropConnections()
+	deadline := time.Now().Add(time.Second)
+	for !conn.IsClosing() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.Put(conn)
+	checkStats(t, p, 0, 0)
+
+	req := ldap.NewSearchRequest("dc=digitalis,dc=io", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)", []string{"dn"}, nil)
+	if _, err := p.Search(req); err != nil {
+		t.Errorf("Search() after the server dropped the connections = %v", err)
+	}
+
+	p.Close()
+	if _, err := p.Get(); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("Get() on a closed pool = %v", err)
+	}
+	checkStats(t, p, 0, 0)
+}
+
+func TestClientCache(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	cache := ld.NewClientCache(1)
+
+	config := s.Config()
+	config.BaseDN = "dc=digitalis,dc=io"
+	c := cache.Get("default", config)
+	if cache.Get("default", config) != c {
+		t.Error("Get() with the same settings returned a new client")
+	}
+	if _, err := c.GetUser("user01"); err != nil {
+		t.Fatal(err)
+	}
+
+	config.UserOU = "ou=users"
+	replaced := cache.Get("default", config)
+	if replaced == c {
+		t.Fatal("Get() with new settings returned the old client")
+	}
+	if _, err := c.GetUser("user01"); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("old client GetUser() = %v, want its pool closed", err)
+	}
+	if _, err := replaced.GetUser("user01"); err != nil {
+		t.Errorf("new client GetUser() = %v", err)
+	}
+	if cache.Get("other", config) == replaced {
+		t.Error("Get() shared a client between servers")
+	}
+}
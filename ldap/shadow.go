@@ -0,0 +1,68 @@
+/*
+Copyright 2021 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ldap
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	ldapv1 "ldap-accounts-controller/api/v1"
+)
+
+// the shadow attributes count days since 1970-01-01
+const day = 24 * time.Hour
+
+// shadowDays returns the shadowExpire value of an ExpiresOn date, empty when
+// it is not set
+func shadowDays(date string) (string, error) {
+	if date == "" {
+		return "", nil
+	}
+	t, err := time.Parse(ldapv1.ExpiryDateFormat, date)
+	if err != nil {
+		return "", fmt.Errorf("invalid expiry date %q: %w", date, err)
+	}
+	return strconv.FormatInt(t.Unix()/int64(day/time.Second), 10), nil
+}
+
+// shadowDate is the reverse of shadowDays, it returns an empty date for
+// values that are not a number of days
+func shadowDate(days string) string {
+	n, err := strconv.ParseInt(days, 10, 64)
+	if err != nil {
+		return ""
+	}
+	return time.Unix(0, 0).UTC().Add(time.Duration(n) * day).Format(ldapv1.ExpiryDateFormat)
+}
+
+// formatDays returns a day count as an attribute value, empty when unset
+func formatDays(days *int64) string {
+	if days == nil {
+		return ""
+	}
+	return strconv.FormatInt(*days, 10)
+}
+
+// parseDays reads a day count attribute, nil when absent or invalid
+func parseDays(value string) *int64 {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
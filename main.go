@@ -19,15 +19,18 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	ldapv1 "ldap-accounts-controller/api/v1"
 	"ldap-accounts-controller/controllers"
+	ld "ldap-accounts-controller/ldap"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -46,11 +49,31 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var ldapServer string
+	var ldapPoolSize int
+	var idPool string
+	var migratePasswords bool
+	var resyncInterval time.Duration
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&ldapServer, "ldap-server", "default",
+		"The LdapServer used by users and groups that do not set spec.server.")
+	flag.StringVar(&idPool, "id-pool", "default",
+		"The LdapIDPool users and groups without a uid or gid get one from, unless they set spec.idPool.")
+	flag.IntVar(&ldapPoolSize, "ldap-pool-size", 10,
+		"The maximum number of connections kept open to each LDAP server.")
+	flag.BoolVar(&migratePasswords, "migrate-inline-passwords", false,
+		"Move the deprecated inline spec.password of LdapUsers into Secrets.")
+	flag.DurationVar(&resyncInterval, "resync-interval", 10*time.Minute,
+		"How often users and groups are compared with LDAP and repaired. 0 disables it.")
+	flag.StringVar(&ldapv1.UserDefaults.HomeBase, "default-home-base", ldapv1.UserDefaults.HomeBase,
+		"Directory users without spec.homedir get their home directory in.")
+	flag.StringVar(&ldapv1.UserDefaults.Shell, "default-shell", ldapv1.UserDefaults.Shell,
+		"Login shell of users without spec.shell.")
 	flag.Parse()
+	ldapv1.DefaultServer = ldapServer
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
@@ -66,22 +89,48 @@ func main() {
 		os.Exit(1)
 	}
 
+	ldapClients := ld.NewClientCache(ldapPoolSize)
+	metrics.Registry.MustRegister(ldapClients)
+
 	if err = (&controllers.LdapGroupReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("LdapGroup"),
-		Scheme: mgr.GetScheme(),
+		Client:         mgr.GetClient(),
+		Log:            ctrl.Log.WithName("controllers").WithName("LdapGroup"),
+		Scheme:         mgr.GetScheme(),
+		DefaultServer:  ldapServer,
+		DefaultIDPool:  idPool,
+		LdapClients:    ldapClients,
+		Recorder:       mgr.GetEventRecorderFor("ldapgroup-controller"),
+		ResyncInterval: resyncInterval,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LdapGroup")
 		os.Exit(1)
 	}
 	if err = (&controllers.LdapUserReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("LdapUser"),
-		Scheme: mgr.GetScheme(),
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("LdapUser"),
+		Scheme:           mgr.GetScheme(),
+		DefaultServer:    ldapServer,
+		DefaultIDPool:    idPool,
+		LdapClients:      ldapClients,
+		Recorder:         mgr.GetEventRecorderFor("ldapuser-controller"),
+		MigratePasswords: migratePasswords,
+		ResyncInterval:   resyncInterval,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LdapUser")
 		os.Exit(1)
 	}
+	// the webhook server needs certificates, set ENABLE_WEBHOOKS=false to
+	// run the manager locally without them
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&ldapv1.LdapUser{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "LdapUser")
+			os.Exit(1)
+		}
+		if err = (&ldapv1.LdapGroup{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "LdapGroup")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")